@@ -0,0 +1,117 @@
+package agollo
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// KeyAccess is how a key is read by ConfigReader since Init, tracked when WithAccessTracking is set
+	KeyAccess struct {
+		Namespace string `json:"namespace"`
+		Key       string `json:"key"`
+		// times the key is read, 0 for a key in config never read
+		Count    int64     `json:"count"`
+		LastRead time.Time `json:"lastRead,omitempty"`
+		// times the key is not found in any layer, it may be a typo or a removed key
+		MissingCount int64 `json:"missingCount"`
+		// a default value is used when the key is not found, at the last read
+		DefaultUsed bool `json:"defaultUsed"`
+	}
+
+	accessFile struct {
+		DumpTime time.Time   `json:"dumpTime"`
+		Keys     []KeyAccess `json:"keys"`
+	}
+)
+
+var (
+	gAccess      = make(map[string]map[string]*KeyAccess)
+	gAccessMutex sync.Mutex
+)
+
+func accessTrackingEnabled() bool {
+	return gOption != nil && gOption.accessTracking
+}
+
+// recordAccess counts a read of key, found is false if no layer has the key
+func recordAccess(namespaceName, key string, found bool) {
+	if !accessTrackingEnabled() {
+		return
+	}
+	gAccessMutex.Lock()
+	defer gAccessMutex.Unlock()
+	kv, ok := gAccess[namespaceName]
+	if !ok {
+		kv = make(map[string]*KeyAccess)
+		gAccess[namespaceName] = kv
+	}
+	ka, ok := kv[key]
+	if !ok {
+		ka = &KeyAccess{Namespace: namespaceName, Key: key}
+		kv[key] = ka
+	}
+	ka.Count++
+	ka.LastRead = time.Now()
+	ka.DefaultUsed = false
+	if !found {
+		ka.MissingCount++
+		_, ka.DefaultUsed = gDefault[namespaceName][key]
+	}
+}
+
+// GetAccessStats returns reads of keys sorted by namespace and key, keys of watched namespaces
+// never read are included with Count 0, which are likely dead config
+func GetAccessStats() []KeyAccess {
+	namespaces := make(map[string]struct{})
+	for _, ns := range GetNamespaceList() {
+		namespaces[ns] = struct{}{}
+	}
+	gAccessMutex.Lock()
+	for ns := range gAccess {
+		namespaces[ns] = struct{}{}
+	}
+	gAccessMutex.Unlock()
+
+	var ret []KeyAccess
+	for ns := range namespaces {
+		keys := layerKeys(getLayers(), ns)
+		gAccessMutex.Lock()
+		for _, k := range keys {
+			if _, ok := gAccess[ns][k]; !ok {
+				ret = append(ret, KeyAccess{Namespace: ns, Key: k})
+			}
+		}
+		for _, ka := range gAccess[ns] {
+			ret = append(ret, *ka)
+		}
+		gAccessMutex.Unlock()
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// DumpAccessStats writes GetAccessStats to file in JSON, file is replaced atomically,
+// it is called periodically after Start if WithAccessDump is set
+func DumpAccessStats(path string) error {
+	b, err := json.MarshalIndent(accessFile{DumpTime: time.Now(), Keys: GetAccessStats()}, "", "\t")
+	if err != nil {
+		return errors.WithMessage(err, "json.MarshalIndent")
+	}
+	return errors.WithMessage(writeFileAtomic(path, append(b, '\n')), "writeFileAtomic")
+}
+
+// ResetAccessStats clears reads tracked so far
+func ResetAccessStats() {
+	gAccessMutex.Lock()
+	gAccess = make(map[string]map[string]*KeyAccess)
+	gAccessMutex.Unlock()
+}
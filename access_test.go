@@ -0,0 +1,65 @@
+package agollo
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAccess_Stats(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	defer ResetAccessStats()
+	WithAccessTracking().apply(gOption)
+	WithDefaultVals(map[string]interface{}{"retry": 3}, "application").apply(gOption)
+	bkDefault := gDefault
+	defer func() { gDefault = bkDefault }()
+	gDefault = gOption.defaultVals
+	setTestConfig("application", map[string]string{"timeout": "1s", "stale": "x"})
+
+	cr := GetConfigReader("application")
+	_, _ = cr.GetDurationValue("timeout")
+	_, _ = cr.GetStringValue("timeout")
+	_, _ = cr.GetIntValue("retry")
+	_, _ = cr.GetStringValue("timout")
+
+	stats := GetAccessStats()
+	assert.Len(t, stats, 4)
+	assert.Equal(t, KeyAccess{Namespace: "application", Key: "stale"}, stats[1])
+	assert.Equal(t, int64(1), stats[0].MissingCount)
+	assert.True(t, stats[0].DefaultUsed)
+	assert.Equal(t, "timeout", stats[2].Key)
+	assert.Equal(t, int64(2), stats[2].Count)
+	assert.Zero(t, stats[2].MissingCount)
+	assert.False(t, stats[2].LastRead.IsZero())
+	assert.Equal(t, "timout", stats[3].Key)
+	assert.False(t, stats[3].DefaultUsed)
+
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.json")
+	assert.Nil(t, DumpAccessStats(path))
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	af := accessFile{}
+	assert.Nil(t, json.Unmarshal(b, &af))
+	assert.Len(t, af.Keys, 4)
+
+	// keys returned by GetByPrefix are read
+	ResetAccessStats()
+	assert.Len(t, cr.GetByPrefix("st"), 1)
+	counts := make(map[string]int64)
+	for _, ka := range GetAccessStats() {
+		counts[ka.Key] = ka.Count
+	}
+	assert.Equal(t, int64(1), counts["stale"])
+	assert.Equal(t, int64(0), counts["timeout"])
+
+	ResetAccessStats()
+	gOption.accessTracking = false
+	_, _ = cr.GetStringValue("timeout")
+	assert.Empty(t, GetAccessStats())
+}
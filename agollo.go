@@ -11,7 +11,6 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/ratelimit"
 	"golang.org/x/net/context"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +24,24 @@ type (
 		GetFloatValue(key string) (float64, error)
 		GetBoolValue(key string) (bool, error)
 		GetBytesValue(key string) ([]byte, error)
+		GetDurationValue(key string) (time.Duration, error)
+		GetInt64Value(key string) (int64, error)
+		GetUintValue(key string) (uint, error)
+		GetByteSizeValue(key string) (int64, error)
+		GetTimeValue(key string) (time.Time, error)
+		GetStringSliceValue(key string) ([]string, error)
+		GetMapValue(key string) (map[string]interface{}, error)
+		GetSliceValue(key string) ([]interface{}, error)
+
+		// Keys returns keys of namespace in all ListingSource layers, sorted
+		Keys() []string
+		// GetAll returns values of Keys with ENC(...) decrypted, each key returned is tracked as read
+		GetAll() map[string]string
+		// GetByPrefix returns values of keys starting with prefix, keys are not trimmed,
+		// each key returned is tracked as read
+		GetByPrefix(prefix string) map[string]string
+		// GetReleaseKey returns release of namespace in cache, empty if it is not loaded
+		GetReleaseKey() string
 	}
 	configReader string
 
@@ -32,35 +49,36 @@ type (
 		NamespaceName  string `json:"namespaceName"`
 		releaseKey     string `json:"-"`
 		NotificationId int64  `json:"notificationId"`
+		// time the release in cache is fetched from apollo, the one saved in backup if it is loaded from backup
+		fetchTime time.Time
 	}
 	service struct {
 		apollo.ConfigCenter
 		namespaceList []*namespace
-	}
-
-	defaultVal struct {
-		s string
-		i int
-		f float64
-		b bool
+		// set by WithLocalDir, namespaces are read from it instead of apollo
+		local *localProvider
 	}
 )
 
 // CHandler calls a handler to process config change event
 type CHandler func(event *ChangeEvent) error
 
+// EHandler calls a handler to process error event
+type EHandler func(event *ErrorEvent)
+
 const (
 	DEFAULT_NOFICATION_ID = -1
 )
 
 var (
-	gOption    *option
-	gInitOnce  sync.Once
-	gStartOnce sync.Once
-	gService   *service
-	gDefault   map[string]defaultVal
-	gCallback  CHandler
-	rateLimit  = ratelimit.New(2)
+	gOption        *option
+	gInitOnce      sync.Once
+	gStartOnce     sync.Once
+	gService       *service
+	gDefault       map[string]map[string]defaultVal
+	gCallback      CHandler
+	gErrorCallback EHandler
+	rateLimit      = ratelimit.New(2)
 )
 
 func Init(opts ...Option) (err error) {
@@ -71,16 +89,25 @@ func Init(opts ...Option) (err error) {
 				return
 			}
 		}()
-		gOption = newDefaultOption()
-		for _, opt := range opts {
-			opt.apply(gOption)
+		o, e := buildOption(opts)
+		if e != nil {
+			err = e
+			return
 		}
+		gOption = o
 
 		if gOption.defaultVals != nil {
 			gDefault = gOption.defaultVals
 		}
 
-		if gOption.ApolloAddr == "" {
+		for ns, schema := range gOption.schemas {
+			if e := schema.compile(); e != nil {
+				err = errors.WithMessage(e, "schema of "+ns)
+				return
+			}
+		}
+
+		if gOption.ApolloAddr == "" && gOption.localDir == "" {
 			err = errors.New("ApolloAddr not set")
 			return
 		}
@@ -91,10 +118,11 @@ func Init(opts ...Option) (err error) {
 		apollo.RetryInterval = gOption.retryInterval
 		s := &service{
 			ConfigCenter: apollo.ConfigCenter{
-				Host:     apollo.NewSingleHostResolver(gOption.ApolloAddr),
-				AppId:    gOption.AppId,
-				Cluster:  gOption.Cluster,
-				ClientIp: gOption.clientIp,
+				Host:            apollo.NewSingleHostResolver(gOption.ApolloAddr),
+				AppId:           gOption.AppId,
+				Cluster:         gOption.Cluster,
+				ClientIp:        gOption.clientIp,
+				AccessKeySecret: gOption.AccessKeySecret,
 			},
 		}
 		nl := strings.Split(gOption.NamespaceName, ",")
@@ -106,7 +134,30 @@ func Init(opts ...Option) (err error) {
 				NotificationId: DEFAULT_NOFICATION_ID,
 			}
 		}
+		if gOption.localDir != "" {
+			s.local = &localProvider{dir: gOption.localDir}
+			if e := s.local.check(s.namespaceList); e != nil {
+				err = errors.WithMessage(e, "WithLocalDir")
+				return
+			}
+		}
 		gService = s
+		if e := gEmergency.load(); e != nil {
+			logger.LogError("load overrides fail: %v", e)
+		}
+		for _, l := range gOption.layers {
+			if ns, ok := l.src.(NotifyingSource); ok {
+				src := l.src
+				ns.SetNotify(func(event *ChangeEvent) {
+					onSourceChange(src, event)
+				})
+			}
+		}
+		if gOption.backupCrypto != nil {
+			if e := reencryptBackups(s.namespaceList); e != nil {
+				logger.LogError("reencryptBackups fail: %v", e)
+			}
+		}
 		if !gOption.quickInitWithBK {
 			err = s.syncConfig(true, nil)
 			if err != nil {
@@ -143,48 +194,103 @@ func GetConfigReader(namespaceName string) ConfigReader {
 
 // start agollo
 func (s *service) start(ctx context.Context) {
-	t1 := time.NewTimer(gOption.refreshInterval)
+	t1 := time.NewTimer(s.refreshInterval())
+	var dumpC <-chan time.Time
+	if gOption.accessDumpPath != "" && gOption.accessDumpEvery > 0 {
+		t2 := time.NewTicker(gOption.accessDumpEvery)
+		defer t2.Stop()
+		dumpC = t2.C
+	}
 	for {
 		select {
 		case <-t1.C:
 			_ = s.syncConfig(false, nil)
-			t1.Reset(gOption.refreshInterval)
+			t1.Reset(s.refreshInterval())
+		case <-dumpC:
+			if err := DumpAccessStats(gOption.accessDumpPath); err != nil {
+				logger.LogError("DumpAccessStats fail: %v", err)
+			}
 		case <-ctx.Done():
 			break
 		default:
 			rateLimit.Take()
-			s.pullNotify()
+			if s.local == nil {
+				s.pullNotify()
+			}
 		}
 	}
 }
 
+// refreshInterval returns interval of syncing all namespaces, files are polled by it in local mode
+func (s *service) refreshInterval() time.Duration {
+	if s.local != nil {
+		return gOption.localPollInterval
+	}
+	return gOption.refreshInterval
+}
+
+// fetchConfig gets release of namespace from apollo, or from file in local mode
+func (s *service) fetchConfig(v *namespace) (*apollo.Config, error) {
+	if s.local != nil {
+		return s.local.SyncConfig(v.NamespaceName, v.releaseKey)
+	}
+	return s.ConfigCenter.SyncConfig(v.NamespaceName, v.releaseKey, v.NotificationId)
+}
+
 func (s *service) syncConfig(isInit bool, nm []*namespace) error {
 	if nm == nil {
 		nm = s.namespaceList
 	}
 	var retErr *multierror.Error
 	var event = make(map[string]*ChangeEvent)
+	gApplyMutex.Lock()
 	for _, v := range nm {
-		cfg, err := s.ConfigCenter.SyncConfig(v.NamespaceName, v.releaseKey, v.NotificationId)
+		fromBackup := false
+		fetchTime := time.Now()
+		cfg, err := s.fetchConfig(v)
+		if err == nil && cfg != nil {
+			if err = checkRelease(v, cfg, fetchTime); err != nil {
+				cfg = nil
+			}
+		}
+		if err == nil || errors.Cause(err) == apollo.ErrSameRelease {
+			recordSynced(v.NamespaceName)
+		}
+		if err == nil && cfg != nil {
+			v.fetchTime = fetchTime
+		}
 		if err != nil || (cfg == nil && isInit) {
 			logger.LogError(fmt.Sprintf("sync namespace [%s] config failed %v", v.NamespaceName, err))
 			retErr = multierror.Append(apollo.NewMutliError(), err)
 			if isInit {
-				path := getConfigPath(v.NamespaceName)
-				cfg, err = loadConfigFile(path)
+				dc, err := loadFallback(v.NamespaceName)
 				if err != nil {
-					retErr = multierror.Append(retErr, errors.WithMessage(err, "loadConfigFile "+v.NamespaceName))
+					retErr = multierror.Append(retErr, errors.WithMessage(err, "loadBackup "+v.NamespaceName))
 					continue
 				}
+				cfg = dc.Config
+				v.fetchTime = dc.FetchTime
+				fromBackup = true
 			}
 		}
 		if cfg != nil {
-			event[v.NamespaceName] = getChangeEvent(cfg)
-			updateCache(cfg, v, event[v.NamespaceName])
+			e := getChangeEvent(cfg)
+			var effective []*ChangeEvent
+			if fromBackup || s.local != nil {
+				// backup of local files is useless
+				effective = updateMemoryCache(cfg, v, e)
+			} else {
+				effective = updateCache(cfg, v, e)
+			}
+			for _, d := range effective {
+				mergeChangeEvent(event, d)
+			}
 		}
 	}
+	gApplyMutex.Unlock()
 	if !isInit {
-		for _, v := range nm {
+		// namespaces depending on the synced ones may be changed too
+		for _, v := range s.namespaceList {
 			if e, ok := event[v.NamespaceName]; ok {
 				pushChange(v, e)
 			}
@@ -197,23 +303,33 @@ func (s *service) syncConfig(isInit bool, nm []*namespace) error {
 	return nil
 }
 
+// mergeChangeEvent puts e into events by namespace, changes of the same namespace are appended
+func mergeChangeEvent(events map[string]*ChangeEvent, e *ChangeEvent) {
+	if old, ok := events[e.Namespace]; ok {
+		old.Changes = append(old.Changes, e.Changes...)
+		return
+	}
+	events[e.Namespace] = e
+}
+
 func (s *service) LoadConfigFile(nm []*namespace) error {
 	if nm == nil {
 		nm = s.namespaceList
 	}
 	for _, v := range nm {
-		path := getConfigPath(v.NamespaceName)
-		cfg, err := loadConfigFile(path)
+		dc, err := loadFallback(v.NamespaceName)
 		if err != nil {
-			return errors.WithMessage(err, "loadConfigFile "+v.NamespaceName)
+			return errors.WithMessage(err, "loadFallback "+v.NamespaceName)
 		}
+		cfg := dc.Config
+		v.fetchTime = dc.FetchTime
 
 		if cfg != nil {
 			if cfg.NamespaceName != v.NamespaceName {
 				return errors.New(fmt.Sprintf("namespace miss match: [%v, %v]", cfg.NamespaceName, v.NamespaceName))
 			}
 			event := getChangeEvent(cfg)
-			updateCache(cfg, v, event)
+			updateMemoryCache(cfg, v, event)
 		}
 	}
 	return nil
@@ -261,87 +377,51 @@ func (s *service) updateNotificationId(nf []*apollo.NotifyMsg) (updated []*names
 	return updated
 }
 
-func getConfigPath(namespaceName string) string {
-	return gOption.BackupDir + "/" + namespaceName + gOption.BackupSuffix
-}
-
+// getValue returns value of key with ENC(...) decrypted
 func (cr configReader) getValue(key string) (string, error) {
-	ck := getCacheKey(string(cr), key)
-	cacheMutex.Lock()
-	value, err := gConfigCache.Get([]byte(ck))
-	cacheMutex.Unlock()
+	value, err := cr.getRawValue(key)
+	if err != nil {
+		return EMPTY, err
+	}
+	value, err = decryptValue(value)
 	if err != nil {
 		return EMPTY, errors.WithMessage(err, "getValue "+key)
 	}
-
-	return string(value), nil
+	return value, nil
 }
 
-func (cr configReader) GetStringValue(key string) (string, error) {
-	value, err := cr.getValue(key)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.s, errors.WithMessage(err, "getValue")
+// getRawValue returns value of key from the layer with the highest priority which has it
+func (cr configReader) getRawValue(key string) (string, error) {
+	value, ok := layerValue(getLayers(), string(cr), key)
+	if !ok {
+		return EMPTY, errors.New("getValue " + key + ": not found")
 	}
 	return value, nil
 }
 
-func (cr configReader) GetIntValue(key string) (int, error) {
-	value, err := cr.getValue(key)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.i, errors.WithMessage(err, "getValue")
-	}
+func (cr configReader) GetStringValue(key string) (string, error) {
+	return getParsed(cr, key, "string", parseString, fromString(parseString))
+}
 
-	parsed, err := strconv.Atoi(value)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.i, errors.WithMessage(err, "atoi")
-	}
-	return parsed, nil
+func (cr configReader) GetIntValue(key string) (int, error) {
+	return getParsed(cr, key, "int", parseInt, fromString(parseInt))
 }
 
 func (cr configReader) GetFloatValue(key string) (float64, error) {
-	value, err := cr.getValue(key)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.f, errors.WithMessage(err, "getValue")
-	}
-
-	parsed, err := strconv.ParseFloat(value, 64)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.f, errors.WithMessage(err, "ParseFloat")
-	}
-
-	return parsed, nil
+	return getParsed(cr, key, "float64", parseFloat, fromString(parseFloat))
 }
 
 func (cr configReader) GetBoolValue(key string) (bool, error) {
-	value, err := cr.getValue(key)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.b, errors.WithMessage(err, "getValue")
-	}
-
-	parsed, err := strconv.ParseBool(value)
-	if err != nil {
-		def := gDefault[getCacheKey(string(cr), key)]
-		return def.b, errors.WithMessage(err, "ParseBool")
-	}
-
-	return parsed, nil
+	return getParsed(cr, key, "bool", parseBool, fromString(parseBool))
 }
 
 func (cr configReader) GetBytesValue(key string) ([]byte, error) {
-	ck := getCacheKey(string(cr), key)
-	cacheMutex.Lock()
-	value, err := gConfigCache.Get([]byte(ck))
-	cacheMutex.Unlock()
+	value, err := cr.getValue(key)
+	recordAccess(string(cr), key, err == nil)
 	if err != nil {
-		return nil, errors.WithMessage(err, "GetBytesValue")
+		return getDefault(string(cr), key, defaultBytes), errors.WithMessage(err, "GetBytesValue")
 	}
-	return value, nil
+	return []byte(value), nil
 }
 
 // RegChangeEventHandler register a config change handler on agollo
@@ -349,6 +429,11 @@ func RegChangeEventHandler(in CHandler) {
 	gCallback = in
 }
 
+// RegErrorEventHandler register a handler of releases rejected by the client
+func RegErrorEventHandler(in EHandler) {
+	gErrorCallback = in
+}
+
 // get namespace list being watched
 func GetNamespaceList() []string {
 	var ret []string
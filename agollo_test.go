@@ -8,8 +8,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -25,16 +28,21 @@ var gMockServer = mock.NewServer()
 
 type AgolloSuite struct {
 	basetest.BaseSuite
+	// backups are written to it instead of the files under mock
+	backupDir string
 }
 
 func TestAgollo(t *testing.T) {
-	testSuite := new(AgolloSuite)
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	testSuite := &AgolloSuite{backupDir: dir}
 	testSuite.Register(
 		func() {
 			go gMockServer.Run()
 		},
 		func() {
-			initFileConf(DEFAULT_NAMESPACENAME)
+			initFileConf(dir, DEFAULT_NAMESPACENAME)
 		},
 		nil,
 		func() {
@@ -52,7 +60,7 @@ func (s *AgolloSuite) testLog(format string, v ...interface{}) {
 
 func (s *AgolloSuite) Test_Init_Success() {
 	agOpts := []Option{
-		WithBackupDir("./mock/tmp"),
+		WithBackupDir(s.backupDir),
 		WithBackupSuffix(".json"),
 		WithConfFile("./mock/tmp/apollo.json"),
 		WithLogFunc(s.testLog, s.testLog, s.testLog),
@@ -106,11 +114,10 @@ func (s *AgolloSuite) Test_pullNotify_ModifySuccess() {
 	checkConfigVal(s, releaseKey, releaseKey)
 }
 
-func initFileConf(namespaceName string) {
+func initFileConf(backupDir, namespaceName string) {
 	gOption = newDefaultOption()
-	gOption.BackupDir = "./mock/tmp"
+	gOption.BackupDir = backupDir
 	gOption.BackupSuffix = ".json"
-	path := getConfigPath(namespaceName)
 
 	ac := apollo.Config{
 		ConnConfig: apollo.ConnConfig{
@@ -124,7 +131,7 @@ func initFileConf(namespaceName string) {
 			"a2": TEST_DEFAULT_VAL_A2,
 		},
 	}
-	err := writeConfigFile(&ac, path)
+	err := writeConfigFile(&ac, DEFAULT_NOFICATION_ID, time.Now())
 	if err != nil {
 		fmt.Printf("writeConfigFile fail:%s", err.Error())
 	}
@@ -133,9 +140,9 @@ func initFileConf(namespaceName string) {
 func getTestService(notificationId int64, releaseKey string) (*service, error) {
 	option := newDefaultOption()
 	option.confFile = "./mock/tmp/apollo.json"
-	err := loadJsonConfig(option, option.confFile)
+	err := loadConfFile(option, option.confFile)
 	if err != nil {
-		return nil, errors.WithMessage(err, "loadJsonConfig")
+		return nil, errors.WithMessage(err, "loadConfFile")
 	}
 
 	initCache(option.ConfigCacheSize, false)
@@ -184,3 +191,28 @@ func checkEmptyConf(s *AgolloSuite) {
 	assert.NotNil(s.T(), err)
 	assert.Equal(s.T(), "", a2)
 }
+
+func (s *AgolloSuite) Test_SyncConfig_RejectInvalid() {
+	schema := &Schema{Keys: map[string]KeySchema{
+		"a1": {Type: SCHEMA_STRING, Pattern: "^x"},
+	}}
+	assert.Nil(s.T(), schema.compile())
+	gOption.schemas = map[string]*Schema{"application": schema}
+	var rejected *ErrorEvent
+	RegErrorEventHandler(func(event *ErrorEvent) {
+		rejected = event
+	})
+	defer RegErrorEventHandler(nil)
+
+	releaseKey := "12345678901"
+	service, err := getTestService(-1, releaseKey)
+	assert.Nil(s.T(), err)
+
+	err = service.syncConfig(false, nil)
+	assert.Nil(s.T(), err)
+	checkEmptyConf(s)
+	assert.NotNil(s.T(), rejected)
+	assert.Equal(s.T(), "application", rejected.Namespace)
+	assert.Equal(s.T(), releaseKey+"z", rejected.ReleaseKey)
+	assert.Contains(s.T(), rejected.Err.Error(), "key a1")
+}
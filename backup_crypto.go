@@ -0,0 +1,240 @@
+package agollo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// cipher name stored in encrypted backup file
+	backupCipherAESGCM = "AES-GCM"
+)
+
+type (
+	// KeyProvider provides the AES key used to encrypt backup files, key must be 16, 24 or 32 bytes
+	KeyProvider interface {
+		Key() ([]byte, error)
+	}
+
+	// KeyProviderFunc makes a function a KeyProvider
+	KeyProviderFunc func() ([]byte, error)
+
+	envKeyProvider  string
+	fileKeyProvider string
+
+	// backupCrypto encrypts backup with the current key, previous keys are only used to decrypt
+	backupCrypto struct {
+		mu       sync.RWMutex
+		current  KeyProvider
+		previous []KeyProvider
+	}
+
+	encryptedBackup struct {
+		Cipher string `json:"cipher"`
+		KeyId  string `json:"keyId"`
+		Nonce  []byte `json:"nonce"`
+		Data   []byte `json:"data"`
+	}
+)
+
+func (f KeyProviderFunc) Key() ([]byte, error) {
+	return f()
+}
+
+// NewEnvKeyProvider reads a base64 encoded key from environment variable name
+func NewEnvKeyProvider(name string) KeyProvider {
+	return envKeyProvider(name)
+}
+
+func (p envKeyProvider) Key() ([]byte, error) {
+	v, ok := os.LookupEnv(string(p))
+	if !ok {
+		return nil, errors.New("env " + string(p) + " not set")
+	}
+	return decodeKey(v)
+}
+
+// NewFileKeyProvider reads a base64 encoded key from file path
+func NewFileKeyProvider(path string) KeyProvider {
+	return fileKeyProvider(path)
+}
+
+func (p fileKeyProvider) Key() ([]byte, error) {
+	b, err := ioutil.ReadFile(string(p))
+	if err != nil {
+		return nil, errors.WithMessage(err, "ReadFile")
+	}
+	return decodeKey(string(b))
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.WithMessage(err, "base64 decode key")
+	}
+	return key, nil
+}
+
+func newBackupCrypto(current KeyProvider, previous ...KeyProvider) *backupCrypto {
+	return &backupCrypto{
+		current:  current,
+		previous: previous,
+	}
+}
+
+func keyId(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "aes.NewCipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cipher.NewGCM")
+	}
+	return gcm, nil
+}
+
+func (bc *backupCrypto) encrypt(plain []byte) ([]byte, error) {
+	bc.mu.RLock()
+	kp := bc.current
+	bc.mu.RUnlock()
+
+	key, err := kp.Key()
+	if err != nil {
+		return nil, errors.WithMessage(err, "get backup key")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithMessage(err, "read nonce")
+	}
+
+	eb := encryptedBackup{
+		Cipher: backupCipherAESGCM,
+		KeyId:  keyId(key),
+		Nonce:  nonce,
+		Data:   gcm.Seal(nil, nonce, plain, nil),
+	}
+	return json.MarshalIndent(eb, "", "\t")
+}
+
+// decrypt returns the plain backup and whether it is not encrypted with the current key
+func (bc *backupCrypto) decrypt(eb *encryptedBackup) ([]byte, bool, error) {
+	if eb.Cipher != backupCipherAESGCM {
+		return nil, false, errors.New("unsupported backup cipher " + eb.Cipher)
+	}
+
+	bc.mu.RLock()
+	kps := append([]KeyProvider{bc.current}, bc.previous...)
+	bc.mu.RUnlock()
+
+	for i, kp := range kps {
+		key, err := kp.Key()
+		if err != nil {
+			logger.LogError("get backup key fail: %v", err)
+			continue
+		}
+		if keyId(key) != eb.KeyId {
+			continue
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, false, err
+		}
+		plain, err := gcm.Open(nil, eb.Nonce, eb.Data, nil)
+		if err != nil {
+			return nil, false, errors.WithMessage(err, "gcm.Open")
+		}
+		return plain, i != 0, nil
+	}
+	return nil, false, errors.New(fmt.Sprintf("no backup key matches key id %s", eb.KeyId))
+}
+
+// rotate makes kp the current key, the old current key is kept to decrypt existing backups
+func (bc *backupCrypto) rotate(kp KeyProvider) {
+	bc.mu.Lock()
+	bc.previous = append([]KeyProvider{bc.current}, bc.previous...)
+	bc.current = kp
+	bc.mu.Unlock()
+}
+
+// unwrapBackup decrypts data if it is an encrypted backup,
+// stale is true when data should be rewritten with the current key.
+func unwrapBackup(data []byte) (plain []byte, stale bool, err error) {
+	bc := getBackupCrypto()
+	eb := &encryptedBackup{}
+	if err = json.Unmarshal(data, eb); err != nil || eb.Cipher == "" {
+		// plain backup
+		return data, bc != nil, nil
+	}
+	if bc == nil {
+		return nil, false, errors.New("backup is encrypted but no backup key is configured")
+	}
+	return bc.decrypt(eb)
+}
+
+func wrapBackup(plain []byte) ([]byte, error) {
+	bc := getBackupCrypto()
+	if bc == nil {
+		return plain, nil
+	}
+	return bc.encrypt(plain)
+}
+
+func getBackupCrypto() *backupCrypto {
+	if gOption == nil {
+		return nil
+	}
+	return gOption.backupCrypto
+}
+
+// reencryptBackups rewrites backups of namespaces which are plain or encrypted with a previous key
+func reencryptBackups(nm []*namespace) error {
+	for _, v := range nm {
+		for _, name := range []string{v.NamespaceName, v.NamespaceName + backupPrevSuffix} {
+			err := reencryptConfigFile(name)
+			if err != nil && errors.Cause(err) != ErrBackupNotFound {
+				return errors.WithMessage(err, "reencryptConfigFile "+name)
+			}
+		}
+	}
+	return nil
+}
+
+// RotateBackupKey encrypts backups with kp from now on and re-encrypts existing backups,
+// the old key is still used to read backups that could not be re-encrypted.
+func RotateBackupKey(kp KeyProvider) error {
+	bc := getBackupCrypto()
+	if bc == nil {
+		return errors.New("backup encryption not enabled")
+	}
+	if _, err := kp.Key(); err != nil {
+		return errors.WithMessage(err, "get backup key")
+	}
+	bc.rotate(kp)
+	if gService == nil {
+		return nil
+	}
+	return reencryptBackups(gService.namespaceList)
+}
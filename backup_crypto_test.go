@@ -0,0 +1,60 @@
+package agollo
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func staticKey(b byte) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		return bytes.Repeat([]byte{b}, 32), nil
+	})
+}
+
+func TestBackupCrypto_writeConfigFile_Encrypted(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	gOption.backupCrypto = newBackupCrypto(staticKey(1))
+
+	ac := newTestConfig("r1", map[string]string{"password": "secret-value"})
+	assert.Nil(t, writeConfigFile(ac, DEFAULT_NOFICATION_ID, time.Now()))
+
+	b, err := store.Load(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(b, []byte("secret-value")))
+
+	loaded, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, ac, loaded)
+
+	gOption.backupCrypto = newBackupCrypto(staticKey(2))
+	_, err = loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.NotNil(t, err)
+}
+
+func TestBackupCrypto_reencryptConfigFile_RotateKey(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+
+	// plain backup written before encryption was enabled
+	ac := newTestConfig("r1", map[string]string{"password": "secret-value"})
+	assert.Nil(t, writeConfigFile(ac, DEFAULT_NOFICATION_ID, time.Now()))
+
+	gOption.backupCrypto = newBackupCrypto(staticKey(1))
+	assert.Nil(t, reencryptConfigFile(TEST_DEFAULT_NAMESPACE_NAME))
+	_, stale, err := readDiskConfig(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.False(t, stale)
+
+	gOption.backupCrypto.rotate(staticKey(2))
+	_, stale, err = readDiskConfig(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.True(t, stale)
+	assert.Nil(t, reencryptConfigFile(TEST_DEFAULT_NAMESPACE_NAME))
+
+	gOption.backupCrypto = newBackupCrypto(staticKey(2))
+	loaded, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, ac, loaded)
+}
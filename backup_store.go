@@ -0,0 +1,349 @@
+package agollo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// suffix of the lock file of a backup
+	lockSuffix = ".lock"
+	// lock file of backups in dir, shared by all namespaces, it is hidden and not listed as a backup
+	dirLockName = ".agollo" + lockSuffix
+)
+
+// ErrBackupNotFound is returned by BackupStore.Load when there is no backup of the name
+var ErrBackupNotFound = errors.New("backup not found")
+
+type (
+	// BackupStore saves backups of namespaces, data is opaque to the store.
+	// Load returns ErrBackupNotFound when name is not saved.
+	// List returns backups of namespaces only, previous generations and overrides are saved but not listed.
+	BackupStore interface {
+		Save(name string, data []byte) error
+		Load(name string) ([]byte, error)
+		List() ([]string, error)
+		Delete(name string) error
+	}
+
+	// BackupLocker is implemented by BackupStore shared by processes,
+	// Lock blocks until the lock of name is held and returns the func to release it.
+	BackupLocker interface {
+		Lock(name string, exclusive bool) (unlock func(), err error)
+	}
+
+	// backupLinker is implemented by BackupStore able to keep a copy of a backup without writing it again
+	backupLinker interface {
+		link(name, newName string) error
+	}
+
+	// dirBackupStore saves each backup as a file named dir/name+suffix
+	dirBackupStore struct {
+		dir    string
+		suffix string
+	}
+
+	// archiveBackupStore saves all backups in one tar.gz file, which is locked while it is rewritten
+	archiveBackupStore struct {
+		mu   sync.Mutex
+		path string
+	}
+
+	memoryBackupStore struct {
+		mu   sync.RWMutex
+		data map[string][]byte
+	}
+)
+
+// isNamespaceBackup reports whether name is saved as backup of a namespace,
+// not a previous generation or overrides set by SetOverride
+func isNamespaceBackup(name string) bool {
+	return name != overridesBackupName && !strings.HasSuffix(name, backupPrevSuffix)
+}
+
+// NewDirBackupStore returns a BackupStore saving backup files in dir, one file for each namespace
+func NewDirBackupStore(dir, suffix string) BackupStore {
+	return &dirBackupStore{dir: dir, suffix: suffix}
+}
+
+func (s *dirBackupStore) path(name string) string {
+	return s.dir + "/" + name + s.suffix
+}
+
+func (s *dirBackupStore) Save(name string, data []byte) error {
+	return writeFileAtomic(s.path(name), data)
+}
+
+// link hard links backup of name as newName, the link is made with a temp name and renamed over newName
+func (s *dirBackupStore) link(name, newName string) error {
+	tmp := s.path(newName) + backupTmpSuffix
+	_ = os.Remove(tmp)
+	if err := os.Link(s.path(name), tmp); err != nil {
+		return errors.WithMessage(err, "os.Link")
+	}
+	if err := os.Rename(tmp, s.path(newName)); err != nil {
+		_ = os.Remove(tmp)
+		return errors.WithMessage(err, "os.Rename")
+	}
+	return nil
+}
+
+func (s *dirBackupStore) Load(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "ReadFile")
+	}
+	return data, nil
+}
+
+func (s *dirBackupStore) List() ([]string, error) {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.WithMessage(err, "ReadDir")
+	}
+	var names []string
+	for _, fi := range fis {
+		if fi.IsDir() || fi.Name() == dirLockName || !strings.HasSuffix(fi.Name(), s.suffix) {
+			continue
+		}
+		if name := strings.TrimSuffix(fi.Name(), s.suffix); isNamespaceBackup(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Lock locks all backups in dir with one lock file, so no lock file is left for each namespace
+func (s *dirBackupStore) Lock(name string, exclusive bool) (func(), error) {
+	return lockFile(s.dir+"/"+dirLockName, exclusive)
+}
+
+func (s *dirBackupStore) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithMessage(err, "os.Remove")
+	}
+	return nil
+}
+
+// NewArchiveBackupStore returns a BackupStore saving all backups in a single tar.gz file,
+// the whole archive is rewritten on every Save and Delete.
+func NewArchiveBackupStore(path string) BackupStore {
+	return &archiveBackupStore{path: path}
+}
+
+func (s *archiveBackupStore) read() (map[string][]byte, error) {
+	ret := make(map[string][]byte)
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "os.Open")
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errors.WithMessage(err, "gzip.NewReader")
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.WithMessage(err, "tar Next")
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.WithMessage(err, "tar Read")
+		}
+		ret[hdr.Name] = data
+	}
+	return ret, nil
+}
+
+func (s *archiveBackupStore) write(entries map[string][]byte) error {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		data := entries[name]
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.WithMessage(err, "tar WriteHeader")
+		}
+		if _, err := tw.Write(data); err != nil {
+			return errors.WithMessage(err, "tar Write")
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.WithMessage(err, "tar Close")
+	}
+	if err := gw.Close(); err != nil {
+		return errors.WithMessage(err, "gzip Close")
+	}
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+func (s *archiveBackupStore) lock(exclusive bool) (func(), error) {
+	s.mu.Lock()
+	unlock, err := lockFile(s.path+lockSuffix, exclusive)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlock()
+		s.mu.Unlock()
+	}, nil
+}
+
+// Lock locks all backups in archive with one lock file, other than the one held while the archive is rewritten
+func (s *archiveBackupStore) Lock(name string, exclusive bool) (func(), error) {
+	return lockFile(s.path+".ns"+lockSuffix, exclusive)
+}
+
+func (s *archiveBackupStore) Save(name string, data []byte) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+	entries[name] = data
+	return s.write(entries)
+}
+
+func (s *archiveBackupStore) Load(name string) ([]byte, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := entries[name]
+	if !ok {
+		return nil, ErrBackupNotFound
+	}
+	return data, nil
+}
+
+func (s *archiveBackupStore) List() ([]string, error) {
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		if isNamespaceBackup(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *archiveBackupStore) Delete(name string) error {
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := entries[name]; !ok {
+		return nil
+	}
+	delete(entries, name)
+	return s.write(entries)
+}
+
+// NewMemoryBackupStore returns a BackupStore keeping backups in memory,
+// for read-only file systems and tests.
+func NewMemoryBackupStore() BackupStore {
+	return &memoryBackupStore{data: make(map[string][]byte)}
+}
+
+func (s *memoryBackupStore) Save(name string, data []byte) error {
+	s.mu.Lock()
+	s.data[name] = append([]byte(nil), data...)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryBackupStore) Load(name string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.data[name]
+	if !ok {
+		return nil, ErrBackupNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *memoryBackupStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.data))
+	for name := range s.data {
+		if isNamespaceBackup(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memoryBackupStore) Delete(name string) error {
+	s.mu.Lock()
+	delete(s.data, name)
+	s.mu.Unlock()
+	return nil
+}
+
+// getBackupStore returns the store set by WithBackupStore, or the store of BackupDir by default
+func getBackupStore() BackupStore {
+	if gOption.backupStore != nil {
+		return gOption.backupStore
+	}
+	return NewDirBackupStore(gOption.BackupDir, gOption.BackupSuffix)
+}
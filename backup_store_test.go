@@ -0,0 +1,81 @@
+package agollo
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupStore_SaveLoadListDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	stores := map[string]BackupStore{
+		"dir":     NewDirBackupStore(dir, ".json"),
+		"archive": NewArchiveBackupStore(filepath.Join(dir, "backup.tar.gz")),
+		"memory":  NewMemoryBackupStore(),
+	}
+	for name, store := range stores {
+		_, err := store.Load("application")
+		assert.Equal(t, ErrBackupNotFound, errors.Cause(err), name)
+
+		assert.Nil(t, store.Save("application", []byte("a")), name)
+		assert.Nil(t, store.Save("test.json", []byte("b")), name)
+		assert.Nil(t, store.Save("application", []byte("c")), name)
+		assert.Nil(t, store.Save("application"+backupPrevSuffix, []byte("a")), name)
+		assert.Nil(t, store.Save(overridesBackupName, []byte("{}")), name)
+
+		data, err := store.Load("application")
+		assert.Nil(t, err, name)
+		assert.Equal(t, []byte("c"), data, name)
+
+		names, err := store.List()
+		assert.Nil(t, err, name)
+		assert.ElementsMatch(t, []string{"application", "test.json"}, names, name)
+		// entries not listed are still saved
+		data, err = store.Load("application" + backupPrevSuffix)
+		assert.Nil(t, err, name)
+		assert.Equal(t, []byte("a"), data, name)
+		data, err = store.Load(overridesBackupName)
+		assert.Nil(t, err, name)
+		assert.Equal(t, []byte("{}"), data, name)
+
+		assert.Nil(t, store.Delete("application"), name)
+		_, err = store.Load("application")
+		assert.Equal(t, ErrBackupNotFound, errors.Cause(err), name)
+		_, err = store.Load(overridesBackupName)
+		assert.Nil(t, err, name)
+		assert.Nil(t, store.Delete("test.json"), name)
+		assert.Nil(t, store.Delete("application"+backupPrevSuffix), name)
+		assert.Nil(t, store.Delete(overridesBackupName), name)
+	}
+}
+
+func TestDirBackupStore_SharedLockNoLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer useTestBackupStore(NewDirBackupStore(dir, ".json"))()
+
+	ac := newTestConfig("r1", map[string]string{"a1": "11"})
+	data, err := encodeConfigFile(&diskConfig{Config: ac})
+	assert.Nil(t, err)
+	// backup put in dir by hand, which is never written by the client
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, TEST_DEFAULT_NAMESPACE_NAME+".json"), data, 0644))
+
+	loaded, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, ac, loaded)
+	_, err = os.Stat(filepath.Join(dir, dirLockName))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, writeConfigFile(ac, DEFAULT_NOFICATION_ID, time.Now()))
+	names, err := getBackupStore().List()
+	assert.Nil(t, err)
+	assert.NotContains(t, names, dirLockName)
+}
@@ -0,0 +1,240 @@
+package agollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// struct tag of bound field, for example `apollo:"db.timeout,default=5s"`
+	bindTagName = "apollo"
+	// option of struct tag, all text after it is the default value
+	bindDefaultOption = "default="
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	byteSizeType = reflect.TypeOf(ByteSize(0))
+	bytesType    = reflect.TypeOf([]byte(nil))
+)
+
+// Binding holds a struct filled from a namespace, the struct is rebuilt and swapped
+// when a bound key changes, Load returns the latest one.
+type Binding[T any] struct {
+	namespace  string
+	keys       map[string]struct{}
+	listenerId int64
+	v          atomic.Value
+}
+
+// Bind fills cfg from keys of namespace by struct tags, and keeps it updated in the returned Binding.
+//    type DB struct {
+//        Timeout time.Duration `apollo:"timeout,default=5s"`
+//        Hosts   []string      `apollo:"hosts"`
+//    }
+//    type Config struct {
+//        DB    DB   `apollo:"db"`  // nested struct, keys are prefixed with db.
+//        Debug bool `apollo:"debug,default=false"`
+//    }
+// slice is read from comma separated value or JSON array, map is read from JSON object,
+// fields without tag are ignored, except embedded structs.
+// cfg is only filled once, use Binding.Load to get the struct rebuilt on change.
+func Bind[T any](namespaceName string, cfg *T) (*Binding[T], error) {
+	if cfg == nil {
+		return nil, errors.New("cfg is nil")
+	}
+	if reflect.TypeOf(cfg).Elem().Kind() != reflect.Struct {
+		return nil, errors.New(fmt.Sprintf("cfg %T is not a pointer to struct", cfg))
+	}
+
+	b := &Binding[T]{
+		namespace: namespaceName,
+		keys:      make(map[string]struct{}),
+	}
+	built, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	*cfg = *built
+	b.v.Store(built)
+	b.listenerId = addChangeListener(b.onChange)
+	return b, nil
+}
+
+// Load returns the latest struct, it must not be modified
+func (b *Binding[T]) Load() *T {
+	return b.v.Load().(*T)
+}
+
+// Close stops rebuilding the struct
+func (b *Binding[T]) Close() {
+	removeChangeListener(b.listenerId)
+}
+
+func (b *Binding[T]) onChange(event *ChangeEvent) {
+	if event.Namespace != b.namespace {
+		return
+	}
+	for _, c := range event.Changes {
+		if _, ok := b.keys[c.Key]; !ok {
+			continue
+		}
+		built, err := b.build()
+		if err != nil {
+			logger.LogError("rebuild config bound to %s fail, keep the previous one: %v", b.namespace, err)
+			return
+		}
+		b.v.Store(built)
+		return
+	}
+}
+
+func (b *Binding[T]) build() (*T, error) {
+	cfg := new(T)
+	keys := make(map[string]struct{})
+	err := bindStruct(configReader(b.namespace), reflect.ValueOf(cfg).Elem(), "", keys)
+	if err != nil {
+		return nil, err
+	}
+	// build is called by Bind before listener is added, then only by the listener
+	b.keys = keys
+	return cfg, nil
+}
+
+func bindStruct(cr configReader, v reflect.Value, prefix string, keys map[string]struct{}) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		tag, hasTag := sf.Tag.Lookup(bindTagName)
+		if tag == "-" || !fv.CanSet() {
+			continue
+		}
+		if !hasTag {
+			if sf.Anonymous && fv.Kind() == reflect.Struct {
+				if err := bindStruct(cr, fv, prefix, keys); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		name, def, hasDef := parseBindTag(tag)
+		key := prefix + name
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			if err := bindStruct(cr, fv, key+SEP, keys); err != nil {
+				return err
+			}
+			continue
+		}
+
+		keys[key] = struct{}{}
+		value, err := cr.GetStringValue(key)
+		if err != nil {
+			if !hasDef {
+				continue
+			}
+			value = def
+		}
+		if err = setBindValue(fv, value); err != nil {
+			return cr.newValueError(key, value, fv.Type().String(), err)
+		}
+	}
+	return nil
+}
+
+func parseBindTag(tag string) (name, def string, hasDef bool) {
+	idx := strings.Index(tag, ",")
+	if idx < 0 {
+		return tag, "", false
+	}
+	name = tag[:idx]
+	opt := tag[idx+1:]
+	if strings.HasPrefix(opt, bindDefaultOption) {
+		return name, strings.TrimPrefix(opt, bindDefaultOption), true
+	}
+	return name, "", false
+}
+
+func setBindValue(v reflect.Value, s string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case byteSizeType:
+		bs, err := parseByteSize(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(bs)
+		return nil
+	case timeType:
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case bytesType:
+		v.SetBytes([]byte(s))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return json.Unmarshal([]byte(s), v.Addr().Interface())
+		}
+		items := parseStringSlice(s)
+		sl := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setBindValue(sl.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	case reflect.Map:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	default:
+		return errors.New("unsupported field type " + v.Type().String())
+	}
+	return nil
+}
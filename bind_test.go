@@ -0,0 +1,86 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testBindDB struct {
+	Timeout time.Duration `apollo:"timeout,default=5s"`
+	Hosts   []string      `apollo:"hosts,default=a,b"`
+	Ports   []int         `apollo:"ports"`
+	MaxSize ByteSize      `apollo:"max_size"`
+}
+
+type testBindConfig struct {
+	DB      testBindDB        `apollo:"db"`
+	Debug   bool              `apollo:"debug"`
+	Labels  map[string]string `apollo:"labels"`
+	Ignored string
+}
+
+func TestBind_FillAndRebuild(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	setTestConfig("application", map[string]string{
+		"db.ports":    "[3306, 3307]",
+		"db.max_size": "1MB",
+		"debug":       "true",
+		"labels":      `{"zone":"a"}`,
+		"Ignored":     "x",
+	})
+
+	var cfg testBindConfig
+	b, err := Bind("application", &cfg)
+	assert.Nil(t, err)
+	defer b.Close()
+	expected := testBindConfig{
+		DB: testBindDB{
+			Timeout: 5 * time.Second,
+			Hosts:   []string{"a", "b"},
+			Ports:   []int{3306, 3307},
+			MaxSize: 1 << 20,
+		},
+		Debug:  true,
+		Labels: map[string]string{"zone": "a"},
+	}
+	assert.Equal(t, expected, cfg)
+	assert.Equal(t, &expected, b.Load())
+
+	ns := &namespace{NamespaceName: "application"}
+	cfgs := &apollo.Config{
+		ConnConfig: apollo.ConnConfig{NamespaceName: "application"},
+		Configurations: map[string]string{
+			"db.timeout": "1s",
+			"db.hosts":   "c",
+			"db.ports":   "3306",
+			"debug":      "true",
+		},
+	}
+	updateCache(cfgs, ns, getChangeEvent(cfgs))
+	assert.Equal(t, &testBindConfig{
+		DB: testBindDB{
+			Timeout: time.Second,
+			Hosts:   []string{"c"},
+			Ports:   []int{3306},
+		},
+		Debug: true,
+	}, b.Load())
+
+	// bad value keeps the previous struct
+	last := b.Load()
+	cfgs.Configurations["db.timeout"] = "1 minute"
+	updateCache(cfgs, ns, getChangeEvent(cfgs))
+	assert.Equal(t, last, b.Load())
+}
+
+func TestBind_ParseError(t *testing.T) {
+	setTestConfig("application", map[string]string{
+		"debug": "yes please",
+	})
+	var cfg testBindConfig
+	_, err := Bind("application", &cfg)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `parse key debug value "yes please" as bool`)
+}
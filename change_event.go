@@ -18,6 +18,13 @@ type ChangeEvent struct {
 	Changes   []*ConfigChange
 }
 
+// ErrorEvent is event of a release rejected or held by the client, the last good config is kept
+type ErrorEvent struct {
+	Namespace  string
+	ReleaseKey string
+	Err        error
+}
+
 // ConfigChange contains config change info
 type ConfigChange struct {
 	Key        string
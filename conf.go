@@ -0,0 +1,113 @@
+package agollo
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// confKey is a client option named the same way as apollo java client,
+// env are environment variables read by WithEnv, the first one set wins,
+// prop is the key in app.properties read by WithConfFile
+type confKey struct {
+	env  []string
+	prop string
+	set  func(o *option, v string)
+}
+
+var confKeys = []confKey{
+	{env: []string{"APOLLO_APP_ID", "APP_ID"}, prop: "app.id", set: func(o *option, v string) { o.AppId = v }},
+	{env: []string{"APOLLO_CLUSTER"}, prop: "apollo.cluster", set: func(o *option, v string) { o.Cluster = v }},
+	// config service is used directly, so it wins over meta
+	{env: []string{"APOLLO_CONFIG_SERVICE", "APOLLO_META"}, prop: "apollo.meta", set: func(o *option, v string) { o.ApolloAddr = v }},
+	{prop: "apollo.config-service", set: func(o *option, v string) { o.ApolloAddr = v }},
+	{env: []string{"APOLLO_NAMESPACES"}, prop: "apollo.bootstrap.namespaces", set: func(o *option, v string) { o.NamespaceName = trimNamespaces(v) }},
+	{env: []string{"APOLLO_ACCESS_KEY_SECRET"}, prop: "apollo.access-key.secret", set: func(o *option, v string) { o.AccessKeySecret = v }},
+	{env: []string{"APOLLO_CACHE_DIR"}, prop: "apollo.cache-dir", set: func(o *option, v string) { o.BackupDir = v }},
+}
+
+// buildOption applies opts in a fixed order whatever order they are passed in: defaults,
+// then file of WithConfFile, then environment variables of WithEnv, then the other options, so code wins.
+func buildOption(opts []Option) (*option, error) {
+	o := newDefaultOption()
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	if !o.loadFile && !o.loadEnv {
+		return o, nil
+	}
+
+	ret := newDefaultOption()
+	if o.loadFile {
+		if err := loadConfFile(ret, o.confFile); err != nil {
+			return nil, errors.WithMessage(err, "loadConfFile")
+		}
+	}
+	if o.loadEnv {
+		loadConfEnv(ret)
+	}
+	for _, opt := range opts {
+		opt.apply(ret)
+	}
+	return ret, nil
+}
+
+// loadConfFile loads options from file into opt, options not in file are kept.
+// file in yaml is read by its suffix, file starting with { is json, the other .properties file
+// is read with the keys of apollo java client, like app.id and apollo.meta.
+func loadConfFile(opt *option, fileName string) error {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return errors.WithMessage(err, "ReadFile")
+	}
+
+	ext := strings.ToLower(filepath.Ext(fileName))
+	switch {
+	case ext == ".yaml" || ext == ".yml":
+		err = errors.WithMessage(yaml.Unmarshal(b, opt), "yaml.Unmarshal")
+	case ext == propertiesSuffix && !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")):
+		err = loadConfProperties(opt, b)
+	default:
+		err = errors.WithMessage(json.Unmarshal(b, opt), "json.Unmarshal")
+	}
+	return err
+}
+
+func loadConfProperties(opt *option, b []byte) error {
+	props, err := parseProperties(b)
+	if err != nil {
+		return errors.WithMessage(err, "parseProperties")
+	}
+	for _, ck := range confKeys {
+		if v, ok := props[ck.prop]; ok {
+			ck.set(opt, v)
+		}
+	}
+	return nil
+}
+
+// loadConfEnv loads options set by environment variables into opt
+func loadConfEnv(opt *option) {
+	for _, ck := range confKeys {
+		for _, name := range ck.env {
+			if v, ok := os.LookupEnv(name); ok && v != "" {
+				ck.set(opt, v)
+				break
+			}
+		}
+	}
+}
+
+// trimNamespaces removes spaces around namespaces separated by comma
+func trimNamespaces(s string) string {
+	names := strings.Split(s, ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+	}
+	return strings.Join(names, ",")
+}
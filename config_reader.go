@@ -0,0 +1,203 @@
+package agollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a size in bytes, use it as default value of GetByteSizeValue
+type ByteSize int64
+
+// layouts accepted by GetTimeValue, tried in order
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var (
+	byteSizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+	// byte size units are powers of 1024, KB is the same as KiB
+	byteSizeUnits = map[string]int64{
+		"":    1,
+		"b":   1,
+		"k":   1 << 10,
+		"kb":  1 << 10,
+		"kib": 1 << 10,
+		"m":   1 << 20,
+		"mb":  1 << 20,
+		"mib": 1 << 20,
+		"g":   1 << 30,
+		"gb":  1 << 30,
+		"gib": 1 << 30,
+		"t":   1 << 40,
+		"tb":  1 << 40,
+		"tib": 1 << 40,
+	}
+)
+
+func newParseError(key, value, typ string, err error) error {
+	return errors.WithMessage(err, fmt.Sprintf("parse key %s value %q as %s", key, value, typ))
+}
+
+// getParsed gets value of key and parses it, default value is returned when key is not found or can not be parsed
+func getParsed[T any](cr configReader, key, typ string, parse func(s string) (T, error), conv func(v interface{}) (T, error)) (T, error) {
+	value, err := cr.getValue(key)
+	recordAccess(string(cr), key, err == nil)
+	if err != nil {
+		return getDefault(string(cr), key, conv), errors.WithMessage(err, "getValue")
+	}
+
+	parsed, err := parse(value)
+	if err != nil {
+		return getDefault(string(cr), key, conv), cr.newValueError(key, value, typ, err)
+	}
+	return parsed, nil
+}
+
+// newValueError returns parse error of value read from key, value decrypted from ENC(...) is not shown
+func (cr configReader) newValueError(key, value, typ string, err error) error {
+	if raw, e := cr.getRawValue(key); e == nil && isEncrypted(raw) {
+		// error of parser may contain the value
+		return newParseError(key, maskedValue, typ, errors.New("invalid decrypted value"))
+	}
+	return newParseError(key, value, typ, err)
+}
+
+func (cr configReader) Keys() []string {
+	return layerKeys(getLayers(), string(cr))
+}
+
+func (cr configReader) GetAll() map[string]string {
+	return cr.GetByPrefix("")
+}
+
+func (cr configReader) GetByPrefix(prefix string) map[string]string {
+	ret := make(map[string]string)
+	for _, k := range cr.Keys() {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		value, err := cr.getValue(k)
+		if err != nil {
+			// key is deleted after Keys or can not be decrypted
+			logger.LogError("GetByPrefix %s of %s: %v", k, string(cr), err)
+			continue
+		}
+		recordAccess(string(cr), k, true)
+		ret[k] = value
+	}
+	return ret
+}
+
+func (cr configReader) GetReleaseKey() string {
+	st, _ := lookupNamespaceStatus(string(cr))
+	return st.releaseKey
+}
+
+// GetDurationValue parses value like "300ms", "30s", "1h30m"
+func (cr configReader) GetDurationValue(key string) (time.Duration, error) {
+	return getParsed(cr, key, "duration", parseDuration, fromString(parseDuration))
+}
+
+func (cr configReader) GetInt64Value(key string) (int64, error) {
+	return getParsed(cr, key, "int64", parseInt64, fromString(parseInt64))
+}
+
+func (cr configReader) GetUintValue(key string) (uint, error) {
+	return getParsed(cr, key, "uint", parseUint, fromString(parseUint))
+}
+
+// GetByteSizeValue parses value like "512", "64MB", "1.5GiB" to bytes, units are powers of 1024
+func (cr configReader) GetByteSizeValue(key string) (int64, error) {
+	bs, err := getParsed(cr, key, "byte size", func(s string) (ByteSize, error) {
+		bs, err := parseByteSize(s)
+		return ByteSize(bs), err
+	}, defaultByteSize)
+	return int64(bs), err
+}
+
+// GetTimeValue parses value in RFC3339, "2006-01-02 15:04:05" or "2006-01-02" layout,
+// time without zone is in UTC
+func (cr configReader) GetTimeValue(key string) (time.Time, error) {
+	return getParsed(cr, key, "time", parseTime, fromString(parseTime))
+}
+
+// GetStringSliceValue splits value by comma, each item is trimmed, empty value returns empty slice
+func (cr configReader) GetStringSliceValue(key string) ([]string, error) {
+	return getParsed(cr, key, "string slice", func(s string) ([]string, error) {
+		return parseStringSlice(s), nil
+	}, defaultStringSlice)
+}
+
+// GetMapValue parses value as a JSON object
+func (cr configReader) GetMapValue(key string) (map[string]interface{}, error) {
+	return getParsed(cr, key, "JSON object", parseMap, defaultMap)
+}
+
+// GetSliceValue parses value as a JSON array
+func (cr configReader) GetSliceValue(key string) ([]interface{}, error) {
+	return getParsed(cr, key, "JSON array", parseSlice, defaultSlice)
+}
+
+func parseMap(s string) (map[string]interface{}, error) {
+	var parsed map[string]interface{}
+	err := json.Unmarshal([]byte(s), &parsed)
+	return parsed, err
+}
+
+func parseSlice(s string) ([]interface{}, error) {
+	var parsed []interface{}
+	err := json.Unmarshal([]byte(s), &parsed)
+	return parsed, err
+}
+
+func parseByteSize(s string) (int64, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, errors.New("invalid byte size")
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(m[2])]
+	if !ok {
+		return 0, errors.New("unknown byte size unit " + m[2])
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	size := n * float64(unit)
+	if size > math.MaxInt64 {
+		return 0, errors.New("byte size overflows int64")
+	}
+	return int64(size), nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	var err error
+	for _, layout := range timeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func parseStringSlice(s string) []string {
+	ret := make([]string, 0)
+	if strings.TrimSpace(s) == "" {
+		return ret
+	}
+	for _, v := range strings.Split(s, ",") {
+		ret = append(ret, strings.TrimSpace(v))
+	}
+	return ret
+}
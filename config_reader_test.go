@@ -0,0 +1,141 @@
+package agollo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// setTestConfig puts configurations of namespace into a new cache
+func setTestConfig(namespaceName string, configurations map[string]string) {
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	changes := make([]*ConfigChange, 0, len(configurations))
+	for k, v := range configurations {
+		changes = append(changes, newAddConfigChange(k, v))
+	}
+	_ = doUpdateCache(&ChangeEvent{Namespace: namespaceName, Changes: changes})
+}
+
+func TestConfigReader_TypedGetters(t *testing.T) {
+	setTestConfig("application", map[string]string{
+		"timeout": "1m30s",
+		"id":      "9007199254740993",
+		"count":   "42",
+		"size":    "64MB",
+		"at":      "2020-01-02T03:04:05Z",
+		"hosts":   "a, b,c",
+		"m":       `{"a":1,"b":"x"}`,
+		"arr":     `[1,"x"]`,
+	})
+	cr := GetConfigReader("application")
+
+	d, err := cr.GetDurationValue("timeout")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, d)
+
+	i64, err := cr.GetInt64Value("id")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9007199254740993), i64)
+
+	u, err := cr.GetUintValue("count")
+	assert.Nil(t, err)
+	assert.Equal(t, uint(42), u)
+
+	sz, err := cr.GetByteSizeValue("size")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(64<<20), sz)
+
+	at, err := cr.GetTimeValue("at")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), at)
+
+	hosts, err := cr.GetStringSliceValue("hosts")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, hosts)
+
+	m, err := cr.GetMapValue("m")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": "x"}, m)
+
+	arr, err := cr.GetSliceValue("arr")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{float64(1), "x"}, arr)
+}
+
+func TestConfigReader_TypedGetters_DefaultAndParseError(t *testing.T) {
+	bkDefault := gDefault
+	defer func() { gDefault = bkDefault }()
+
+	o := newDefaultOption()
+	WithDefaultVals(map[string]interface{}{
+		"timeout": 5 * time.Second,
+		"size":    ByteSize(1 << 10),
+		"hosts":   []string{"localhost"},
+	}, "application").apply(o)
+	gDefault = o.defaultVals
+
+	setTestConfig("application", map[string]string{
+		"timeout": "5 seconds",
+	})
+	cr := GetConfigReader("application")
+
+	d, err := cr.GetDurationValue("timeout")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `parse key timeout value "5 seconds" as duration`)
+	assert.Equal(t, 5*time.Second, d)
+
+	sz, err := cr.GetByteSizeValue("size")
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(1<<10), sz)
+
+	hosts, err := cr.GetStringSliceValue("hosts")
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"localhost"}, hosts)
+}
+
+func TestConfigReader_parseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":    512,
+		"1k":     1 << 10,
+		"64MB":   64 << 20,
+		"1.5GiB": 3 << 29,
+		"2 tb":   2 << 40,
+	}
+	for s, expected := range cases {
+		parsed, err := parseByteSize(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, parsed, s)
+	}
+
+	for _, s := range []string{"", "MB", "12XB", "-1"} {
+		_, err := parseByteSize(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestConfigReader_Enumerate(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	WithSource(NewMapSource("embedded", map[string]map[string]string{
+		"application": {"redis.timeout": "1s"},
+	}), PRIORITY_EMBEDDED).apply(gOption)
+	setTestConfig("application", map[string]string{"redis.a": "host-a", "redis.b": "host-b", "db.host": "db"})
+	setTestConfigKeep("application.yaml", map[string]string{"redis.c": "host-c"})
+	recordUpdated("application", "20240101", time.Now())
+
+	cr := GetConfigReader("application")
+	assert.Equal(t, []string{"db.host", "redis.a", "redis.b", "redis.timeout"}, cr.Keys())
+	assert.Equal(t, map[string]string{"redis.a": "host-a", "redis.b": "host-b", "redis.timeout": "1s"}, cr.GetByPrefix("redis."))
+	assert.Len(t, cr.GetAll(), 4)
+	assert.Equal(t, "20240101", cr.GetReleaseKey())
+	assert.Empty(t, GetConfigReader("other").GetReleaseKey())
+	assert.Empty(t, GetConfigReader("other").GetAll())
+}
+
+// setTestConfigKeep puts configurations of namespace into cache without clearing the others
+func setTestConfigKeep(namespaceName string, configurations map[string]string) {
+	changes := make([]*ConfigChange, 0, len(configurations))
+	for k, v := range configurations {
+		changes = append(changes, newAddConfigChange(k, v))
+	}
+	_ = doUpdateCache(&ChangeEvent{Namespace: namespaceName, Changes: changes})
+}
@@ -0,0 +1,265 @@
+package agollo
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Namespace formats, the format of a namespace is the suffix of its name, properties if there is no known suffix
+const (
+	FORMAT_PROPERTIES = "properties"
+	FORMAT_JSON       = "json"
+	FORMAT_YAML       = "yaml"
+	FORMAT_YML        = "yml"
+	FORMAT_XML        = "xml"
+	FORMAT_TXT        = "txt"
+)
+
+type (
+	// Decoder decodes content of a namespace to properties, which are read by ConfigReader with the raw content
+	Decoder interface {
+		Decode(content []byte) (map[string]string, error)
+	}
+
+	// DecoderFunc makes a function a Decoder
+	DecoderFunc func(content []byte) (map[string]string, error)
+)
+
+func (f DecoderFunc) Decode(content []byte) (map[string]string, error) {
+	return f(content)
+}
+
+var (
+	gDecoders = map[string]Decoder{
+		FORMAT_JSON: DecoderFunc(decodeJson),
+		FORMAT_YAML: DecoderFunc(decodeYaml),
+		FORMAT_YML:  DecoderFunc(decodeYaml),
+		FORMAT_XML:  DecoderFunc(decodeXml),
+		FORMAT_TXT:  DecoderFunc(decodeTxt),
+	}
+	gDecodersMutex sync.RWMutex
+)
+
+// RegisterDecoder sets decoder of namespaces whose name ends with "."+format, replaces the built-in one
+//    RegisterDecoder("toml", DecoderFunc(decodeToml))
+func RegisterDecoder(format string, d Decoder) {
+	gDecodersMutex.Lock()
+	gDecoders[strings.ToLower(format)] = d
+	gDecodersMutex.Unlock()
+}
+
+// namespaceFormat returns format of namespace by its suffix
+func namespaceFormat(namespaceName string) string {
+	idx := strings.LastIndex(namespaceName, ".")
+	if idx < 0 {
+		return FORMAT_PROPERTIES
+	}
+	format := strings.ToLower(namespaceName[idx+1:])
+	gDecodersMutex.RLock()
+	_, ok := gDecoders[format]
+	gDecodersMutex.RUnlock()
+	if !ok {
+		return FORMAT_PROPERTIES
+	}
+	return format
+}
+
+// decodeConfigurations returns the raw content with properties decoded from it,
+// configurations of properties namespace or namespace without content are returned as is.
+func decodeConfigurations(namespaceName string, configurations map[string]string) map[string]string {
+	content, ok := configurations[contentKey]
+	if !ok {
+		return configurations
+	}
+	// namespaceFormat takes the read lock itself, which is not reentrant
+	format := namespaceFormat(namespaceName)
+	gDecodersMutex.RLock()
+	d, ok := gDecoders[format]
+	gDecodersMutex.RUnlock()
+	if !ok {
+		return configurations
+	}
+
+	decoded, err := d.Decode([]byte(content))
+	if err != nil {
+		logger.LogError("decode content of %s fail, only raw content is kept: %v", namespaceName, err)
+		decoded = nil
+	}
+	ret := make(map[string]string, len(decoded)+len(configurations))
+	for k, v := range decoded {
+		ret[k] = v
+	}
+	// raw content and other keys are not overwritten by decoded keys
+	for k, v := range configurations {
+		ret[k] = v
+	}
+	return ret
+}
+
+func decodeJson(content []byte) (map[string]string, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(content))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, errors.WithMessage(err, "json Decode")
+	}
+	ret := make(map[string]string)
+	flatten(ret, "", v)
+	return ret, nil
+}
+
+func decodeYaml(content []byte) (map[string]string, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(content, &v); err != nil {
+		return nil, errors.WithMessage(err, "yaml Unmarshal")
+	}
+	ret := make(map[string]string)
+	flatten(ret, "", v)
+	return ret, nil
+}
+
+// txt namespace only has the raw content
+func decodeTxt(content []byte) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// flatten puts v into ret with dotted keys, for example {"db":{"hosts":["a"]}} is flattened to
+// db.hosts[0]=a, and the object and array are also put as JSON, db={"hosts":["a"]} and db.hosts=["a"]
+func flatten(ret map[string]string, prefix string, v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			flatten(ret, joinKey(prefix, k), child)
+		}
+	case map[interface{}]interface{}:
+		for k, child := range t {
+			flatten(ret, joinKey(prefix, fmt.Sprint(k)), child)
+		}
+	case []interface{}:
+		for i, child := range t {
+			flatten(ret, prefix+"["+strconv.Itoa(i)+"]", child)
+		}
+	case nil:
+		if prefix != "" {
+			ret[prefix] = ""
+		}
+		return
+	default:
+		if prefix != "" {
+			ret[prefix] = fmt.Sprint(t)
+		}
+		return
+	}
+
+	if prefix != "" {
+		if b, err := json.Marshal(toJsonValue(v)); err == nil {
+			ret[prefix] = string(b)
+		}
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + SEP + key
+}
+
+// toJsonValue converts map decoded by yaml, which has interface{} keys, to be marshaled by json
+func toJsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			m[fmt.Sprint(k)] = toJsonValue(child)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			m[k] = toJsonValue(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, child := range t {
+			s[i] = toJsonValue(child)
+		}
+		return s
+	}
+	return v
+}
+
+// decodeXml flattens elements by path, the root element is not in the key,
+// attributes are keys under the element, repeated elements are indexed like servers.server[1].
+func decodeXml(content []byte) (map[string]string, error) {
+	type node struct {
+		key      string
+		text     strings.Builder
+		children map[string]int
+	}
+
+	ret := make(map[string]string)
+	d := xml.NewDecoder(bytes.NewReader(content))
+	var stack []*node
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.WithMessage(err, "xml Token")
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{children: make(map[string]int)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				name := t.Name.Local
+				key := joinKey(parent.key, name)
+				if idx := parent.children[name]; idx > 0 {
+					if idx == 1 {
+						// first repeated element is indexed too
+						renameXmlKey(ret, key, key+"[0]")
+					}
+					key += "[" + strconv.Itoa(idx) + "]"
+				}
+				parent.children[name]++
+				n.key = key
+			}
+			for _, attr := range t.Attr {
+				ret[joinKey(n.key, attr.Name.Local)] = attr.Value
+			}
+			stack = append(stack, n)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if text := strings.TrimSpace(n.text.String()); n.key != "" && (text != "" || len(n.children) == 0) {
+				ret[n.key] = text
+			}
+		}
+	}
+	return ret, nil
+}
+
+func renameXmlKey(ret map[string]string, from, to string) {
+	for k, v := range ret {
+		if k == from || strings.HasPrefix(k, from+SEP) {
+			delete(ret, k)
+			ret[to+k[len(from):]] = v
+		}
+	}
+}
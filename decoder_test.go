@@ -0,0 +1,110 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_Formats(t *testing.T) {
+	m, err := decodeJson([]byte(`{"db":{"hosts":["a","b"],"port":3306,"ssl":true,"extra":null}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"db":          `{"extra":null,"hosts":["a","b"],"port":3306,"ssl":true}`,
+		"db.hosts":    `["a","b"]`,
+		"db.hosts[0]": "a",
+		"db.hosts[1]": "b",
+		"db.port":     "3306",
+		"db.ssl":      "true",
+		"db.extra":    "",
+	}, m)
+
+	m, err = decodeYaml([]byte("db:\n  timeout: 5s\n  hosts:\n    - a\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "5s", m["db.timeout"])
+	assert.Equal(t, "a", m["db.hosts[0]"])
+	assert.Equal(t, `{"hosts":["a"],"timeout":"5s"}`, m["db"])
+
+	m, err = decodeXml([]byte(`<config><db port="3306"><host>a</host><host>b</host></db><name> x </name></config>`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"db.port":    "3306",
+		"db.host[0]": "a",
+		"db.host[1]": "b",
+		"name":       "x",
+	}, m)
+
+	_, err = decodeJson([]byte(`{"db":`))
+	assert.NotNil(t, err)
+
+	assert.Equal(t, FORMAT_JSON, namespaceFormat("test.json"))
+	assert.Equal(t, FORMAT_YML, namespaceFormat("app.YML"))
+	assert.Equal(t, FORMAT_PROPERTIES, namespaceFormat("application"))
+	assert.Equal(t, FORMAT_PROPERTIES, namespaceFormat("TEST1.apollo"))
+}
+
+func TestDecoder_Flattened(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+
+	ns := &namespace{NamespaceName: "app.yaml"}
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: "app.yaml"},
+		Configurations: map[string]string{"content": "db:\n  timeout: 5s\n"},
+	}
+	updateCache(cfg, ns, getChangeEvent(cfg))
+	cr := GetConfigReader("app.yaml")
+	d, err := cr.GetDurationValue("db.timeout")
+	assert.Nil(t, err)
+	assert.Equal(t, "5s", d.String())
+	content, err := cr.GetStringValue(contentKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "db:\n  timeout: 5s\n", content)
+
+	cfg.Configurations = map[string]string{"content": "db:\n  port: 1\n"}
+	event := getChangeEvent(cfg)
+	changes := make(map[string]ConfigChangeType)
+	for _, c := range event.Changes {
+		changes[c.Key] = c.ChangeType
+	}
+	assert.Equal(t, map[string]ConfigChangeType{
+		contentKey:   MODIFIED,
+		"db":         MODIFIED,
+		"db.port":    ADDED,
+		"db.timeout": DELETED,
+	}, changes)
+
+	// backup keeps the raw content only
+	updateCache(cfg, ns, event)
+	backup, err := loadConfigFile("app.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, cfg.Configurations, backup.Configurations)
+}
+
+func TestDecoder_Register(t *testing.T) {
+	RegisterDecoder("kv", DecoderFunc(func(content []byte) (map[string]string, error) {
+		ret := make(map[string]string)
+		for _, line := range strings.Split(string(content), "\n") {
+			if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+				ret[kv[0]] = kv[1]
+			}
+		}
+		return ret, nil
+	}))
+	defer func() {
+		gDecodersMutex.Lock()
+		delete(gDecoders, "kv")
+		gDecodersMutex.Unlock()
+	}()
+
+	m := decodeConfigurations("test.kv", map[string]string{"content": "a=1\ncontent=x"})
+	assert.Equal(t, map[string]string{"content": "a=1\ncontent=x", "a": "1"}, m)
+
+	// broken content keeps the raw content only
+	m = decodeConfigurations("test.json", map[string]string{"content": "{"})
+	assert.Equal(t, map[string]string{"content": "{"}, m)
+
+	m = decodeConfigurations("application", map[string]string{"content": `{"a":1}`})
+	assert.Equal(t, map[string]string{"content": `{"a":1}`}, m)
+}
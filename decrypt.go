@@ -0,0 +1,260 @@
+package agollo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Jasypt algorithms supported by NewJasyptDecryptor
+const (
+	// default algorithm of jasypt StandardPBEStringEncryptor
+	JASYPT_PBE_MD5_DES = "PBEWithMD5AndDES"
+	// default algorithm of jasypt-spring-boot 3.x
+	JASYPT_PBE_HMAC_SHA512_AES256 = "PBEWITHHMACSHA512ANDAES_256"
+
+	// default key obtention iterations of jasypt
+	jasyptIterations = 1000
+	encryptedPrefix  = "ENC("
+	// shown instead of a value containing ENC(...), in ChangeEvent and error messages
+	maskedValue = "******"
+)
+
+// ENC(...) may be a whole value or embedded in a value by interpolation
+var encryptedPattern = regexp.MustCompile(`ENC\(([^)]*)\)`)
+
+type (
+	// Decryptor decrypts text wrapped in ENC(...) of values
+	Decryptor interface {
+		Decrypt(ciphertext string) (string, error)
+	}
+
+	// DecryptorFunc makes a function a Decryptor
+	DecryptorFunc func(ciphertext string) (string, error)
+
+	aesDecryptor struct {
+		kp KeyProvider
+	}
+
+	jasyptDecryptor struct {
+		password   []byte
+		algorithm  string
+		iterations int
+	}
+)
+
+func (f DecryptorFunc) Decrypt(ciphertext string) (string, error) {
+	return f(ciphertext)
+}
+
+// NewAESDecryptor decrypts base64 of AES-GCM nonce followed by sealed data, which is made by EncryptAESValue
+func NewAESDecryptor(kp KeyProvider) Decryptor {
+	return &aesDecryptor{kp: kp}
+}
+
+func (d *aesDecryptor) Decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.WithMessage(err, "base64 decode")
+	}
+	key, err := d.kp.Key()
+	if err != nil {
+		return "", errors.WithMessage(err, "get key")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.WithMessage(err, "gcm.Open")
+	}
+	return string(plain), nil
+}
+
+// EncryptAESValue encrypts plain with key to be stored in apollo as ENC(...) and decrypted by NewAESDecryptor
+func EncryptAESValue(key []byte, plain string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.WithMessage(err, "read nonce")
+	}
+	data := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(data) + ")", nil
+}
+
+// NewJasyptDecryptor decrypts values encrypted by jasypt StandardPBEStringEncryptor with password,
+// algorithm is JASYPT_PBE_MD5_DES or JASYPT_PBE_HMAC_SHA512_AES256, with default iterations and base64 output.
+func NewJasyptDecryptor(password, algorithm string) (Decryptor, error) {
+	switch algorithm {
+	case JASYPT_PBE_MD5_DES, JASYPT_PBE_HMAC_SHA512_AES256:
+	default:
+		return nil, errors.New("unsupported jasypt algorithm " + algorithm)
+	}
+	return &jasyptDecryptor{
+		password:   []byte(password),
+		algorithm:  algorithm,
+		iterations: jasyptIterations,
+	}, nil
+}
+
+func (d *jasyptDecryptor) Decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.WithMessage(err, "base64 decode")
+	}
+
+	var block cipher.Block
+	var iv []byte
+	switch d.algorithm {
+	case JASYPT_PBE_MD5_DES:
+		// salt, encrypted, key and iv are derived by PBKDF1
+		if len(data) < des.BlockSize {
+			return "", errors.New("ciphertext too short")
+		}
+		dk := pbkdf1MD5(d.password, data[:des.BlockSize], d.iterations)
+		if block, err = des.NewCipher(dk[:des.BlockSize]); err != nil {
+			return "", errors.WithMessage(err, "des.NewCipher")
+		}
+		iv = dk[des.BlockSize:]
+		data = data[des.BlockSize:]
+	default:
+		// salt, iv, encrypted, key is derived by PBKDF2
+		if len(data) < 2*aes.BlockSize {
+			return "", errors.New("ciphertext too short")
+		}
+		key := pbkdf2SHA512(d.password, data[:aes.BlockSize], d.iterations, 32)
+		if block, err = aes.NewCipher(key); err != nil {
+			return "", errors.WithMessage(err, "aes.NewCipher")
+		}
+		iv = data[aes.BlockSize : 2*aes.BlockSize]
+		data = data[2*aes.BlockSize:]
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return "", errors.New("invalid ciphertext length")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	plain, err = pkcs5Unpad(plain, block.BlockSize())
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func pbkdf1MD5(password, salt []byte, iterations int) []byte {
+	sum := md5.Sum(append(append([]byte{}, password...), salt...))
+	for i := 1; i < iterations; i++ {
+		sum = md5.Sum(sum[:])
+	}
+	return sum[:]
+}
+
+func pbkdf2SHA512(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha512.New, password)
+	var dk []byte
+	for block := uint32(1); len(dk) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], block)
+		prf.Write(n[:])
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		dk = append(dk, t...)
+	}
+	return dk[:keyLen]
+}
+
+func pkcs5Unpad(data []byte, blockSize int) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > blockSize || n > len(data) || !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		// wrong password is mostly found here
+		return nil, errors.New("invalid padding")
+	}
+	return data[:len(data)-n], nil
+}
+
+func getDecryptor() Decryptor {
+	if gOption == nil {
+		return nil
+	}
+	return gOption.decryptor
+}
+
+func isEncrypted(value string) bool {
+	return strings.Contains(value, encryptedPrefix) && encryptedPattern.MatchString(value)
+}
+
+// decryptValue decrypts all ENC(...) in value, value is returned as it is if there is no decryptor
+func decryptValue(value string) (string, error) {
+	d := getDecryptor()
+	if d == nil || !isEncrypted(value) {
+		return value, nil
+	}
+	var retErr error
+	plain := encryptedPattern.ReplaceAllStringFunc(value, func(s string) string {
+		p, err := d.Decrypt(encryptedPattern.FindStringSubmatch(s)[1])
+		if err != nil {
+			retErr = err
+			return s
+		}
+		return p
+	})
+	if retErr != nil {
+		// error does not contain the value, it may be partly decrypted
+		return "", errors.WithMessage(retErr, "decrypt")
+	}
+	return plain, nil
+}
+
+// maskValue hides value containing ENC(...), so plaintext decrypted from it is never shown
+func maskValue(value string) string {
+	if isEncrypted(value) {
+		return maskedValue
+	}
+	return value
+}
+
+// maskChangeEvent returns event with encrypted values masked, event is not modified
+func maskChangeEvent(event *ChangeEvent) *ChangeEvent {
+	masked := &ChangeEvent{
+		Namespace: event.Namespace,
+		Changes:   make([]*ConfigChange, len(event.Changes)),
+	}
+	for i, c := range event.Changes {
+		masked.Changes[i] = &ConfigChange{
+			Key:        c.Key,
+			OldValue:   maskValue(c.OldValue),
+			NewValue:   maskValue(c.NewValue),
+			ChangeType: c.ChangeType,
+		}
+	}
+	return masked
+}
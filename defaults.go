@@ -0,0 +1,156 @@
+package agollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultVal is a default value of any type, it is converted to the type of getter on demand
+type defaultVal struct {
+	v interface{}
+}
+
+// getDefault returns default value of key in namespace converted by conv,
+// zero value is returned if there is no default value or it can not be converted.
+func getDefault[T any](namespaceName, key string, conv func(v interface{}) (T, error)) T {
+	var zero T
+	d, ok := gDefault[namespaceName][key]
+	if !ok || d.v == nil {
+		return zero
+	}
+	if t, ok := d.v.(T); ok {
+		return t
+	}
+	t, err := conv(d.v)
+	if err != nil {
+		logger.LogError("convert default value of %s %s to %T fail: %v", namespaceName, key, zero, err)
+		return zero
+	}
+	return t
+}
+
+// fromString converts default value to string and parses it
+func fromString[T any](parse func(s string) (T, error)) func(v interface{}) (T, error) {
+	return func(v interface{}) (T, error) {
+		return parse(defaultString(v))
+	}
+}
+
+// defaultString formats default value the same way as it is stored in apollo,
+// slice is joined by comma, map is in JSON.
+func defaultString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return t.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = defaultString(rv.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	case reflect.Map, reflect.Struct:
+		b, err := json.Marshal(v)
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func defaultBytes(v interface{}) ([]byte, error) {
+	return []byte(defaultString(v)), nil
+}
+
+// defaultByteSize accepts integer default as bytes
+func defaultByteSize(v interface{}) (ByteSize, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ByteSize(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ByteSize(rv.Uint()), nil
+	}
+	bs, err := parseByteSize(defaultString(v))
+	return ByteSize(bs), err
+}
+
+func defaultStringSlice(v interface{}) ([]string, error) {
+	return parseStringSlice(defaultString(v)), nil
+}
+
+// defaultSlice accepts slice of any type, string default is parsed as JSON array
+func defaultSlice(v interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		ret := make([]interface{}, rv.Len())
+		for i := range ret {
+			ret[i] = rv.Index(i).Interface()
+		}
+		return ret, nil
+	}
+	var ret []interface{}
+	err := json.Unmarshal([]byte(defaultString(v)), &ret)
+	return ret, err
+}
+
+// defaultMap accepts map of any type, string default is parsed as JSON object
+func defaultMap(v interface{}) (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	err := json.Unmarshal([]byte(defaultString(v)), &ret)
+	return ret, err
+}
+
+func parseInt(s string) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(s))
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+func parseBool(s string) (bool, error) {
+	return strconv.ParseBool(strings.TrimSpace(s))
+}
+
+func parseInt64(s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+}
+
+func parseUint(s string) (uint, error) {
+	u, err := strconv.ParseUint(strings.TrimSpace(s), 10, strconv.IntSize)
+	return uint(u), err
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	return time.ParseDuration(strings.TrimSpace(s))
+}
+
+func parseString(s string) (string, error) {
+	return s, nil
+}
+
+func addDefaultVals(defaults map[string]map[string]defaultVal, val map[string]interface{}, namespaceName string) {
+	nd, ok := defaults[namespaceName]
+	if !ok {
+		nd = make(map[string]defaultVal)
+		defaults[namespaceName] = nd
+	}
+	for k, v := range val {
+		nd[k] = defaultVal{v: v}
+	}
+}
@@ -0,0 +1,64 @@
+package agollo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDefaults_WithDefaultVals_ConvertOnDemand(t *testing.T) {
+	bkDefault := gDefault
+	defer func() { gDefault = bkDefault }()
+
+	o := newDefaultOption()
+	for _, opt := range []Option{
+		WithDefaultVals(map[string]interface{}{
+			"port":    "8080",
+			"timeout": 3 * time.Second,
+		}, "application"),
+		WithDefaultVals(map[string]interface{}{
+			"hosts": []string{"a", "b"},
+			"ids":   []int{1, 2},
+		}, "application"),
+		WithDefaultVals(map[string]interface{}{
+			"port":  int64(3306),
+			"ratio": float32(0.5),
+			"size":  1024,
+		}, "mysql"),
+	} {
+		opt.apply(o)
+	}
+	gDefault = o.defaultVals
+	setTestConfig("application", map[string]string{})
+
+	cr := GetConfigReader("application")
+	port, err := cr.GetIntValue("port")
+	assert.NotNil(t, err)
+	assert.Equal(t, 8080, port)
+	portStr, _ := cr.GetStringValue("port")
+	assert.Equal(t, "8080", portStr)
+
+	timeout, _ := cr.GetDurationValue("timeout")
+	assert.Equal(t, 3*time.Second, timeout)
+	timeoutStr, _ := cr.GetStringValue("timeout")
+	assert.Equal(t, "3s", timeoutStr)
+
+	hosts, _ := cr.GetStringSliceValue("hosts")
+	assert.Equal(t, []string{"a", "b"}, hosts)
+	ids, _ := cr.GetSliceValue("ids")
+	assert.Equal(t, []interface{}{1, 2}, ids)
+	idsStr, _ := cr.GetStringValue("ids")
+	assert.Equal(t, "1,2", idsStr)
+
+	mysql := GetConfigReader("mysql")
+	mysqlPort, _ := mysql.GetIntValue("port")
+	assert.Equal(t, 3306, mysqlPort)
+	ratio, _ := mysql.GetFloatValue("ratio")
+	assert.Equal(t, 0.5, ratio)
+	size, _ := mysql.GetByteSizeValue("size")
+	assert.Equal(t, int64(1024), size)
+
+	// default that can not be converted returns zero value
+	b, _ := cr.GetBoolValue("hosts")
+	assert.False(t, b)
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"github.com/Shonminh/apollo-client"
 	"log"
-	"sync/atomic"
-	"unsafe"
 )
 
 type testcfg struct {
@@ -20,8 +18,6 @@ type rediscfg struct {
 	B bool `json:"b"`
 }
 
-var curtTestCfg *testcfg
-
 var logger golog
 
 type golog struct {
@@ -54,22 +50,26 @@ func main() {
 	agollo.RegChangeEventHandler(HandleAll)
 
 	fmt.Println("Initilization done")
-	crt := agollo.GetConfigReader("test.json")
-	crm := agollo.GetConfigReader("mysql.json")
-	crr := agollo.GetConfigReader("redis.json")
-
-	test, _ := crt.GetBytesValue("content")
-	mysql, _ := crm.GetBytesValue("content")
-	redis, _ := crr.GetBytesValue("content")
-
-	var first testcfg
-	var second mysqlcfg
-	var third rediscfg
-	json.Unmarshal(test, &first)
-	json.Unmarshal(mysql, &second)
-	json.Unmarshal(redis, &third)
+	testObj, err := agollo.RegisterObject("test.json", &testcfg{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	testObj.OnUpdate(func(old, new *testcfg) {
+		fmt.Printf("updated config: %v\n", new)
+	})
+	mysqlObj, err := agollo.RegisterObject("mysql.json", &mysqlcfg{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	redisObj, err := agollo.RegisterObject("redis.json", &rediscfg{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	fmt.Printf("\n%v\n%v\n%v\n", first, second, third)
+	fmt.Printf("\n%v\n%v\n%v\n", testObj.Load(), mysqlObj.Load(), redisObj.Load())
 
 	go agollo.Start()
 
@@ -84,25 +84,5 @@ func HandleAll(event *agollo.ChangeEvent) error {
 	bytes, _ := json.Marshal(event)
 	fmt.Println("event:", string(bytes))
 
-	switch event.Namespace {
-	case "test.json":
-		var newVal testcfg
-		content := []byte(event.Changes[0].NewValue)
-
-		if err := json.Unmarshal(content, &newVal); err != nil {
-			return err
-		}
-		ptr := (*unsafe.Pointer)(unsafe.Pointer(&curtTestCfg))
-		atomic.StorePointer(ptr, unsafe.Pointer(&newVal))
-		fmt.Printf("updated config: %v\n", curtTestCfg)
-
-	case "mysql.json":
-		// do something
-	case "redis.json":
-		// do something
-	default:
-		// maybe do nothing
-	}
-
 	return nil
 }
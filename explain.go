@@ -0,0 +1,130 @@
+package agollo
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// source of value loaded from backup by the remote layer
+	sourceBackup = "backup"
+	// source of value loaded from the bundle of WithEmbeddedFallback by the remote layer
+	sourceEmbedded = "embedded-fallback"
+	// source of default value set by WithDefaultVals
+	sourceDefault = "default"
+)
+
+type (
+	// Explanation tells where the value of a key came from
+	Explanation struct {
+		Namespace string `json:"namespace"`
+		Key       string `json:"key"`
+		// false if no layer or default value has the key
+		Found bool `json:"found"`
+		// effective value as it is stored, ENC(...) is not decrypted
+		Value string `json:"value"`
+		// name of the layer, "backup" or "embedded-fallback" if remote config is not from apollo, or "default"
+		Source string `json:"source"`
+		// remote value before placeholders are resolved, empty if it has no placeholder
+		Raw string `json:"raw,omitempty"`
+		// release of the namespace in cache, and the time it is fetched from apollo,
+		// the fetch time saved in backup if it is loaded from backup, zero if unknown
+		ReleaseKey string    `json:"releaseKey"`
+		FetchTime  time.Time `json:"fetchTime"`
+		// time the backup was taken if remote config is loaded from backup
+		BackupTime time.Time `json:"backupTime,omitempty"`
+		// values of lower layers and default value, from high priority to low
+		Shadowed []ShadowedValue `json:"shadowed,omitempty"`
+	}
+
+	// ShadowedValue is a value not used because a higher layer has the key
+	ShadowedValue struct {
+		Source string `json:"source"`
+		Value  string `json:"value"`
+	}
+)
+
+// Explain returns the effective value of key in namespace, its source and the shadowed values
+func Explain(namespaceName, key string) *Explanation {
+	ex := &Explanation{
+		Namespace: namespaceName,
+		Key:       key,
+	}
+	st, ok := lookupNamespaceStatus(namespaceName)
+	if ok {
+		ex.ReleaseKey = st.releaseKey
+		ex.FetchTime = st.fetchTime
+		if st.fromBackup {
+			ex.BackupTime = st.backupTime
+		}
+	}
+
+	for _, l := range getLayers() {
+		v, ok := l.src.Get(namespaceName, key)
+		if !ok {
+			continue
+		}
+		source := l.src.Name()
+		if source == remoteSourceName {
+			if st.fromBackup {
+				source = sourceBackup
+			} else if st.fromEmbedded {
+				source = sourceEmbedded
+			}
+			if raw := getRawRemoteValue(namespaceName, key); !ex.Found && raw != "" && raw != v {
+				ex.Raw = raw
+			}
+			ex.setValue(source, v)
+			if gIgnoreNameSpace {
+				ex.Shadowed = append(ex.Shadowed, getMergedShadowed(key)...)
+			}
+			continue
+		}
+		ex.setValue(source, v)
+	}
+	if d, ok := gDefault[namespaceName][key]; ok {
+		ex.setValue(sourceDefault, defaultString(d.v))
+	}
+	return ex
+}
+
+func (ex *Explanation) setValue(source, value string) {
+	if !ex.Found {
+		ex.Found = true
+		ex.Source = source
+		ex.Value = value
+		return
+	}
+	ex.Shadowed = append(ex.Shadowed, ShadowedValue{Source: source, Value: value})
+}
+
+// getRawRemoteValue returns remote value before interpolation, empty if interpolation is disabled
+func getRawRemoteValue(namespaceName, key string) string {
+	gRawMutex.Lock()
+	defer gRawMutex.Unlock()
+	return gRaw[namespaceName][key]
+}
+
+// ExplainHandler serves Explain as JSON for debugging, namespace and key are query parameters,
+// namespace is application if it is not set.
+//    http.Handle("/debug/apollo/explain", ExplainHandler())
+//    curl 'localhost:8080/debug/apollo/explain?namespace=application&key=timeout'
+func ExplainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespaceName := r.URL.Query().Get("namespace")
+		if namespaceName == "" {
+			namespaceName = DEFAULT_NAMESPACENAME
+		}
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		_ = enc.Encode(Explain(namespaceName, key))
+	})
+}
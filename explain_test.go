@@ -0,0 +1,88 @@
+package agollo
+
+import (
+	"encoding/json"
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	defer useTestInterpolation()()
+	bkDefault := gDefault
+	defer func() {
+		gDefault = bkDefault
+	}()
+	gDefault = map[string]map[string]defaultVal{"application": {"db.port": {v: 3306}}}
+	overrides := NewOverrideSource()
+	WithSource(overrides, PRIORITY_OVERRIDE).apply(gOption)
+	overrides.Set("application", "db.port", "3308")
+
+	cfg := &apollo.Config{
+		ConnConfig: apollo.ConnConfig{NamespaceName: "application", ReleaseKey: "r1"},
+		Configurations: map[string]string{
+			"db.port": "3307",
+			"db.host": "localhost",
+			"url":     "${db.host}:3306",
+		},
+	}
+	fetchTime := time.Now().Add(-time.Minute)
+	updateCache(cfg, &namespace{NamespaceName: "application", fetchTime: fetchTime}, getChangeEvent(cfg))
+
+	ex := Explain("application", "db.port")
+	assert.True(t, ex.Found)
+	assert.Equal(t, "3308", ex.Value)
+	assert.Equal(t, "override", ex.Source)
+	assert.Equal(t, "r1", ex.ReleaseKey)
+	assert.True(t, fetchTime.Equal(ex.FetchTime))
+	assert.Equal(t, []ShadowedValue{{Source: "remote", Value: "3307"}, {Source: "default", Value: "3306"}}, ex.Shadowed)
+
+	ex = Explain("application", "url")
+	assert.Equal(t, "localhost:3306", ex.Value)
+	assert.Equal(t, "${db.host}:3306", ex.Raw)
+
+	ex = Explain("application", "missing")
+	assert.False(t, ex.Found)
+
+	// remote config loaded from backup
+	recordBackupLoaded("application", ex.FetchTime, false)
+	defer recordBackupWritten("application", ex.FetchTime)
+	ex = Explain("application", "db.host")
+	assert.Equal(t, "backup", ex.Source)
+
+	rec := httptest.NewRecorder()
+	ExplainHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?key=db.port", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var got Explanation
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, "3308", got.Value)
+
+	rec = httptest.NewRecorder()
+	ExplainHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?namespace=application", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExplain_FetchTimeOfBackup(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	fetchTime := time.Now().Add(-time.Hour)
+	data, err := encodeConfigFile(&diskConfig{
+		Config:     newTestConfig("r1", map[string]string{"a1": "11"}),
+		BackupTime: fetchTime.Add(time.Minute),
+		FetchTime:  fetchTime,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, store.Save(TEST_DEFAULT_NAMESPACE_NAME, data))
+
+	s := &service{namespaceList: []*namespace{{NamespaceName: TEST_DEFAULT_NAMESPACE_NAME}}}
+	assert.Nil(t, s.LoadConfigFile(nil))
+	ex := Explain(TEST_DEFAULT_NAMESPACE_NAME, "a1")
+	assert.Equal(t, "backup", ex.Source)
+	assert.Equal(t, "r1", ex.ReleaseKey)
+	assert.True(t, fetchTime.Equal(ex.FetchTime))
+	assert.True(t, fetchTime.Add(time.Minute).Equal(ex.BackupTime))
+}
@@ -3,52 +3,280 @@
 package agollo
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/Shonminh/apollo-client/internal/apollo"
 	"github.com/Shonminh/apollo-client/internal/logger"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// suffix of the previous good backup generation
+	backupPrevSuffix = ".prev"
+	// suffix of the temp file a backup is written to before rename
+	backupTmpSuffix = ".tmp"
+	// prefix of the checksum stored in backup file
+	checksumPrefix = "sha256:"
+)
+
+var (
+	errChecksumMismatch = errors.New("backup checksum mismatch")
+	// another process has written a newer release to the backup
+	errNewerBackup = errors.New("backup has newer release")
 )
 
 type diskConfig struct {
 	*apollo.Config
+	NotificationId int64 `json:"notificationId,omitempty"`
+	// time the backup was taken, zero in backup written by older version
+	BackupTime time.Time `json:"backupTime"`
+	// time the release is fetched from apollo, a release fetched later is newer, even if it is a rollback
+	FetchTime time.Time `json:"fetchTime"`
+	Checksum  string    `json:"checksum,omitempty"`
 }
 
-// write config to file
-func writeConfigFile(config *apollo.Config, configPath string) error {
+// write config to backup store
+// the replaced backup is kept as previous generation if it is good, then it is replaced atomically, never missing.
+// backup is not replaced if another process has written a newer release, which is fetched later than config,
+// zero fetchTime is taken as now.
+func writeConfigFile(config *apollo.Config, notificationId int64, fetchTime time.Time) error {
 	if config == nil {
 		logger.LogError("apollo config is null can not write backup file")
 		return errors.New("apollo config is null can not write backup file")
 	}
-	file, e := os.Create(configPath)
+	backupTime := time.Now()
+	if fetchTime.IsZero() {
+		fetchTime = backupTime
+	}
+	data, e := encodeConfigFile(&diskConfig{Config: config, NotificationId: notificationId, BackupTime: backupTime, FetchTime: fetchTime})
 	if e != nil {
 		logger.LogError("writeConfigFile fail: %v", e)
 		return e
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "\t")
+	store := getBackupStore()
+	name := config.NamespaceName
+	unlock, e := lockBackup(store, name, true)
+	if e != nil {
+		logger.LogError("writeConfigFile lock fail: %v", e)
+		return e
+	}
+	defer unlock()
+
+	if old, e := store.Load(name); e == nil {
+		dc, _, e := decodeConfigFile(old)
+		if e == nil && dc.FetchTime.After(fetchTime) && dc.ReleaseKey != config.ReleaseKey {
+			logger.LogError("backup of %v has newer release %v written by another process, fetched at %v after %v",
+				name, dc.ReleaseKey, dc.FetchTime, fetchTime)
+			recordNewerBackup(name, dc.ReleaseKey)
+			return errNewerBackup
+		}
+		// only a good backup is kept as previous generation, a broken one is overwritten
+		if e == nil {
+			if e = keepPrevious(store, name, old); e != nil {
+				logger.LogError("keep previous backup fail: %v", e)
+			}
+		}
+	}
+
+	if e = store.Save(name, data); e != nil {
+		logger.LogError("writeConfigFile fail: %v", e)
+		return e
+	}
+	recordBackupWritten(name, backupTime)
+	return nil
+}
+
+// keepPrevious keeps backup of name, whose data is old, as previous generation before it is replaced,
+// the backup is hard linked if store supports it, or copied
+func keepPrevious(store BackupStore, name string, old []byte) error {
+	if l, ok := store.(backupLinker); ok {
+		err := l.link(name, name+backupPrevSuffix)
+		if err == nil {
+			return nil
+		}
+		logger.LogInfo("link previous backup of %v fail: %v, copy it", name, err)
+	}
+	return store.Save(name+backupPrevSuffix, old)
+}
+
+// load config from backup store
+func loadConfigFile(namespaceName string) (*apollo.Config, error) {
+	dc, e := loadDiskConfig(namespaceName)
+	if e != nil {
+		return nil, e
+	}
+	return dc.Config, nil
+}
+
+// loadDiskConfig loads backup of namespace with its metadata,
+// falls back to the previous generation when the backup is broken.
+func loadDiskConfig(namespaceName string) (*diskConfig, error) {
+	logger.LogInfo("load config file of: %v", namespaceName)
+	unlock, e := lockBackup(getBackupStore(), namespaceName, false)
+	if e != nil {
+		return nil, errors.WithMessage(e, "lock backup")
+	}
+	defer unlock()
+
+	dc, _, e := readDiskConfig(namespaceName)
+	if e == nil {
+		return dc, nil
+	}
 
-	dConfig := diskConfig{Config: config}
-	return encoder.Encode(dConfig)
+	logger.LogError("load config file %v fail: %v, try previous generation", namespaceName, e)
+	dc, _, prevErr := readDiskConfig(namespaceName + backupPrevSuffix)
+	if prevErr != nil {
+		return nil, e
+	}
+	return dc, nil
 }
 
-// load config from file
-func loadConfigFile(configPath string) (*apollo.Config, error) {
-	logger.LogInfo("load config file from: %v", configPath)
-	file, e := os.Open(configPath)
+// lockBackup locks backup of name if store is shared by processes
+func lockBackup(store BackupStore, name string, exclusive bool) (func(), error) {
+	if locker, ok := store.(BackupLocker); ok {
+		return locker.Lock(name, exclusive)
+	}
+	return func() {}, nil
+}
+
+func readConfigFile(name string) (*apollo.Config, error) {
+	dc, _, e := readDiskConfig(name)
 	if e != nil {
-		return nil, errors.WithMessage(e, "os.Open")
+		return nil, e
 	}
-	defer file.Close()
+	return dc.Config, nil
+}
 
-	dConfig := &diskConfig{}
-	e = json.NewDecoder(file).Decode(dConfig)
+// readDiskConfig reads backup, stale is true when the backup should be re-encrypted
+func readDiskConfig(name string) (*diskConfig, bool, error) {
+	data, e := getBackupStore().Load(name)
+	if e != nil {
+		return nil, false, errors.WithMessage(e, "Load")
+	}
+	return decodeConfigFile(data)
+}
 
+func decodeConfigFile(data []byte) (*diskConfig, bool, error) {
+	data, stale, e := unwrapBackup(data)
 	if e != nil {
-		return nil, errors.WithMessage(e, "json Decode")
+		return nil, false, errors.WithMessage(e, "decrypt backup")
 	}
 
-	return dConfig.Config, nil
+	dc := &diskConfig{}
+	e = json.Unmarshal(data, dc)
+	if e != nil {
+		return nil, false, errors.WithMessage(e, "json Decode")
+	}
+	if dc.Config == nil {
+		return nil, false, errors.New("empty backup file")
+	}
+
+	// backup written by older version has no checksum
+	if dc.Checksum != "" {
+		checksum, e := configChecksum(dc.Config)
+		if e != nil {
+			return nil, false, e
+		}
+		if checksum != dc.Checksum {
+			return nil, false, errChecksumMismatch
+		}
+	}
+
+	return dc, stale, nil
+}
+
+// reencryptConfigFile rewrites the backup in place if it is not encrypted with the current key
+func reencryptConfigFile(name string) error {
+	store := getBackupStore()
+	unlock, e := lockBackup(store, name, true)
+	if e != nil {
+		return errors.WithMessage(e, "lock backup")
+	}
+	defer unlock()
+
+	data, e := store.Load(name)
+	if e != nil {
+		return errors.WithMessage(e, "Load")
+	}
+	dc, stale, e := decodeConfigFile(data)
+	if e != nil || !stale {
+		return e
+	}
+	data, e = encodeConfigFile(dc)
+	if e != nil {
+		return e
+	}
+	return store.Save(name, data)
+}
+
+// encodeConfigFile marshals dc with checksum of its config, and encrypts it if backup encryption is enabled
+func encodeConfigFile(dc *diskConfig) ([]byte, error) {
+	checksum, e := configChecksum(dc.Config)
+	if e != nil {
+		return nil, e
+	}
+	dc.Checksum = checksum
+	data, e := json.MarshalIndent(dc, "", "\t")
+	if e != nil {
+		return nil, errors.WithMessage(e, "json.Marshal")
+	}
+	data = append(data, '\n')
+	data, e = wrapBackup(data)
+	if e != nil {
+		return nil, errors.WithMessage(e, "encrypt backup")
+	}
+	return data, nil
+}
+
+func configChecksum(config *apollo.Config) (string, error) {
+	// map keys are sorted by json.Marshal, so the output is stable
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", errors.WithMessage(err, "json.Marshal")
+	}
+	sum := sha256.Sum256(b)
+	return checksumPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// writeFileAtomic writes data to a temp file in the same directory, syncs it and renames it to path,
+// so path either holds the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, name+backupTmpSuffix)
+	if err != nil {
+		return errors.WithMessage(err, "ioutil.TempFile")
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.WithMessage(err, "Write")
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.WithMessage(err, "Sync")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.WithMessage(err, "Close")
+	}
+	if err = os.Rename(tmpName, path); err != nil {
+		return errors.WithMessage(err, "os.Rename")
+	}
+
+	// persist the rename, not supported on every platform so error is ignored
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
 }
@@ -0,0 +1,157 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestConfig(releaseKey string, configurations map[string]string) *apollo.Config {
+	return &apollo.Config{
+		ConnConfig: apollo.ConnConfig{
+			AppId:         TEST_DEFAULT_APPID,
+			Cluster:       TEST_DEFAULT_CLUSTER,
+			NamespaceName: TEST_DEFAULT_NAMESPACE_NAME,
+			ReleaseKey:    releaseKey,
+		},
+		Configurations: configurations,
+	}
+}
+
+// useTestBackupStore sets a default option using store, call the returned func to restore gOption
+func useTestBackupStore(store BackupStore) func() {
+	bkOpt := gOption
+	gOption = newDefaultOption()
+	gOption.backupStore = store
+	return func() { gOption = bkOpt }
+}
+
+func TestFile_writeConfigFile_LoadSameConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer useTestBackupStore(NewDirBackupStore(dir, ".json"))()
+
+	ac := newTestConfig("r1", map[string]string{"a1": "11"})
+	assert.Nil(t, writeConfigFile(ac, DEFAULT_NOFICATION_ID, time.Now()))
+
+	loaded, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, ac, loaded)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+backupTmpSuffix+"*"))
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestFile_loadConfigFile_TruncatedFallbackPrevious(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+
+	first := newTestConfig("r1", map[string]string{"a1": "11"})
+	assert.Nil(t, writeConfigFile(first, DEFAULT_NOFICATION_ID, time.Now()))
+	assert.Nil(t, writeConfigFile(newTestConfig("r2", map[string]string{"a1": "22"}), DEFAULT_NOFICATION_ID, time.Now()))
+
+	b, err := store.Load(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Save(TEST_DEFAULT_NAMESPACE_NAME, b[:len(b)/2]))
+
+	loaded, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, first, loaded)
+}
+
+func TestFile_writeConfigFile_LinkPrevious(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer useTestBackupStore(NewDirBackupStore(dir, ".json"))()
+
+	first := newTestConfig("r1", map[string]string{"a1": "11"})
+	assert.Nil(t, writeConfigFile(first, DEFAULT_NOFICATION_ID, time.Now()))
+	fi, err := os.Stat(filepath.Join(dir, TEST_DEFAULT_NAMESPACE_NAME+".json"))
+	assert.Nil(t, err)
+	assert.Nil(t, writeConfigFile(newTestConfig("r2", map[string]string{"a1": "22"}), DEFAULT_NOFICATION_ID, time.Now()))
+
+	// previous generation is the file replaced
+	prev, err := os.Stat(filepath.Join(dir, TEST_DEFAULT_NAMESPACE_NAME+backupPrevSuffix+".json"))
+	assert.Nil(t, err)
+	assert.True(t, os.SameFile(fi, prev))
+	loaded, err := readConfigFile(TEST_DEFAULT_NAMESPACE_NAME + backupPrevSuffix)
+	assert.Nil(t, err)
+	assert.Equal(t, first, loaded)
+	files, err := filepath.Glob(filepath.Join(dir, "*"+backupTmpSuffix+"*"))
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestFile_loadConfigFile_ChecksumMismatch(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+
+	assert.Nil(t, writeConfigFile(newTestConfig("r1", map[string]string{"a1": "11"}), DEFAULT_NOFICATION_ID, time.Now()))
+
+	b, err := store.Load(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	b = []byte(strings.Replace(string(b), `"11"`, `"12"`, 1))
+	assert.Nil(t, store.Save(TEST_DEFAULT_NAMESPACE_NAME, b))
+
+	_, err = readConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.NotNil(t, err)
+	_, err = loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.NotNil(t, err)
+}
+
+func TestFile_writeConfigFile_KeepNewerRelease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer useTestBackupStore(NewDirBackupStore(dir, ".json"))()
+	now := time.Now()
+
+	// written by another process which fetched a newer release
+	newer := newTestConfig("r2", map[string]string{"a1": "22"})
+	assert.Nil(t, writeConfigFile(newer, 12, now))
+
+	err = writeConfigFile(newTestConfig("r1", map[string]string{"a1": "11"}), 20, now.Add(-time.Second))
+	assert.Equal(t, errNewerBackup, err)
+	loaded, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, newer, loaded)
+	assert.Equal(t, "r2", getTestNamespaceStatus(t).NewerBackup)
+
+	// rollback to r1 is fetched later
+	rollback := newTestConfig("r1", map[string]string{"a1": "11"})
+	assert.Nil(t, writeConfigFile(rollback, 13, now.Add(time.Second)))
+	loaded, err = loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, rollback, loaded)
+	assert.Empty(t, getTestNamespaceStatus(t).NewerBackup)
+}
+
+func TestFile_writeConfigFile_Concurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer useTestBackupStore(NewDirBackupStore(dir, ".json"))()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ac := newTestConfig("r", map[string]string{"a1": strconv.Itoa(i)})
+			assert.Nil(t, writeConfigFile(ac, DEFAULT_NOFICATION_ID, time.Now()))
+			_, err := loadConfigFile(TEST_DEFAULT_NAMESPACE_NAME)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+}
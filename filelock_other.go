@@ -0,0 +1,22 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package agollo
+
+import (
+	"sync"
+)
+
+var fileLocks sync.Map
+
+// lockFile only locks path inside the process, flock is not available on this platform
+func lockFile(path string, exclusive bool) (func(), error) {
+	v, _ := fileLocks.LoadOrStore(path, &sync.RWMutex{})
+	mu := v.(*sync.RWMutex)
+	if exclusive {
+		mu.Lock()
+		return mu.Unlock, nil
+	}
+	mu.RLock()
+	return mu.RUnlock, nil
+}
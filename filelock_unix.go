@@ -0,0 +1,53 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build aix darwin dragonfly freebsd linux netbsd openbsd
+
+package agollo
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"syscall"
+)
+
+// lockFile locks path with flock, the lock is shared between processes on the same host.
+// only an exclusive lock creates the lock file, a shared lock is not held when the lock file
+// is missing or can not be opened, like in a read-only dir, as no process can be writing then.
+func lockFile(path string, exclusive bool) (func(), error) {
+	flag := os.O_RDONLY
+	if exclusive {
+		flag = os.O_CREATE | os.O_RDWR
+	}
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil && !exclusive && unlockedRead(err) {
+		return func() {}, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "os.OpenFile")
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err = syscall.Flock(int(file.Fd()), how)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, errors.WithMessage(err, "flock")
+	}
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+func unlockedRead(err error) bool {
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return true
+	}
+	pe, ok := err.(*os.PathError)
+	return ok && pe.Err == syscall.EROFS
+}
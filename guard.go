@@ -0,0 +1,193 @@
+package agollo
+
+import (
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Guard actions, applied when a release trips the guard of its namespace
+const (
+	// drop the release and keep the last good config
+	GUARD_REFUSE GuardAction = iota
+	// hold the release until it is confirmed by ConfirmRelease
+	GUARD_HOLD
+)
+
+// GuardAction decides what to do with a suspicious release
+type GuardAction int
+
+var (
+	// ErrReleaseRefused is cause of ErrorEvent of a release refused by guard
+	ErrReleaseRefused = errors.New("release refused by guard")
+	// ErrReleaseHeld is cause of ErrorEvent of a release held by guard
+	ErrReleaseHeld = errors.New("release held by guard")
+)
+
+type (
+	// Guard is safety policy of a namespace against releases wiping the cache
+	Guard struct {
+		// max percent of existing keys a release may delete, 0 means no limit
+		MaxDeletePercent float64
+		// refuse release without any key
+		RefuseEmpty bool
+		Action      GuardAction
+	}
+
+	// HeldRelease is a release held by guard
+	HeldRelease struct {
+		Namespace  string
+		ReleaseKey string
+		// why the release is held
+		Reason string
+		HeldAt time.Time
+	}
+
+	blockedRelease struct {
+		HeldRelease
+		ns  *namespace
+		cfg *apollo.Config
+		// time the release is fetched, it is the fetch time of the release in cache once confirmed
+		fetchTime time.Time
+		// false if release is refused
+		held bool
+	}
+)
+
+var (
+	// last blocked release of namespace, an alert is sent once for each release
+	gBlocked      = make(map[string]*blockedRelease)
+	gBlockedMutex sync.Mutex
+	// held by sync and ConfirmRelease while releases are applied to cache,
+	// so a confirmed release never overwrites a newer one applied by sync
+	gApplyMutex sync.Mutex
+)
+
+// checkRelease validates release fetched at fetchTime and applies guard of its namespace,
+// a blocked release is reported by error event and not applied.
+func checkRelease(ns *namespace, cfg *apollo.Config, fetchTime time.Time) error {
+	err := validateConfig(cfg)
+	held := false
+	if err == nil {
+		held, err = guardRelease(cfg)
+	}
+
+	gBlockedMutex.Lock()
+	defer gBlockedMutex.Unlock()
+	if err == nil {
+		delete(gBlocked, ns.NamespaceName)
+		return nil
+	}
+	if b, ok := gBlocked[ns.NamespaceName]; ok && b.ReleaseKey == cfg.ReleaseKey {
+		// the same release is got again by refresh, only alert once
+		return err
+	}
+	gBlocked[ns.NamespaceName] = &blockedRelease{
+		HeldRelease: HeldRelease{
+			Namespace:  ns.NamespaceName,
+			ReleaseKey: cfg.ReleaseKey,
+			Reason:     err.Error(),
+			HeldAt:     time.Now(),
+		},
+		ns:        ns,
+		cfg:       cfg,
+		fetchTime: fetchTime,
+		held:      held,
+	}
+	pushError(&ErrorEvent{Namespace: ns.NamespaceName, ReleaseKey: cfg.ReleaseKey, Err: err})
+	return err
+}
+
+// guardRelease returns error if release trips guard of its namespace, and whether it is held
+func guardRelease(cfg *apollo.Config) (bool, error) {
+	if gOption == nil {
+		return false, nil
+	}
+	g, ok := gOption.guards[cfg.NamespaceName]
+	if !ok {
+		return false, nil
+	}
+
+	var reason string
+	if g.RefuseEmpty && len(cfg.Configurations) == 0 {
+		reason = "release is empty"
+	} else if g.MaxDeletePercent > 0 {
+		event := getChangeEvent(cfg)
+		added, deleted := 0, 0
+		for _, c := range event.Changes {
+			switch c.ChangeType {
+			case ADDED:
+				added++
+			case DELETED:
+				deleted++
+			}
+		}
+		existing := len(effectiveConfigurations(cfg)) - added + deleted
+		if existing > 0 {
+			percent := float64(deleted) * 100 / float64(existing)
+			if percent > g.MaxDeletePercent {
+				reason = fmt.Sprintf("release deletes %d of %d keys, more than %v%%", deleted, existing, g.MaxDeletePercent)
+			}
+		}
+	}
+	if reason == "" {
+		return false, nil
+	}
+
+	if g.Action == GUARD_HOLD {
+		return true, errors.WithMessage(ErrReleaseHeld, reason)
+	}
+	return false, errors.WithMessage(ErrReleaseRefused, reason)
+}
+
+// GetHeldReleases returns releases held by guard and waiting for confirmation
+func GetHeldReleases() []HeldRelease {
+	gBlockedMutex.Lock()
+	defer gBlockedMutex.Unlock()
+	ret := make([]HeldRelease, 0)
+	for _, b := range gBlocked {
+		if b.held {
+			ret = append(ret, b.HeldRelease)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Namespace < ret[j].Namespace
+	})
+	return ret
+}
+
+// ConfirmRelease applies the release of namespace held by guard, releaseKey must be the one held
+func ConfirmRelease(namespaceName, releaseKey string) error {
+	gApplyMutex.Lock()
+	gBlockedMutex.Lock()
+	b, ok := gBlocked[namespaceName]
+	if !ok || !b.held || b.ReleaseKey != releaseKey {
+		gBlockedMutex.Unlock()
+		gApplyMutex.Unlock()
+		return errors.New(fmt.Sprintf("release %s of %s is not held", releaseKey, namespaceName))
+	}
+	delete(gBlocked, namespaceName)
+	gBlockedMutex.Unlock()
+
+	logger.LogInfo("release %s of %s is confirmed", releaseKey, namespaceName)
+	b.ns.fetchTime = b.fetchTime
+	effective := updateCache(b.cfg, b.ns, getChangeEvent(b.cfg))
+	gApplyMutex.Unlock()
+
+	for _, e := range effective {
+		ns := b.ns
+		if e.Namespace != ns.NamespaceName {
+			// namespace depending on the confirmed one
+			ns = nil
+			if gService != nil {
+				ns = gService.findNamespace(e.Namespace)
+			}
+		}
+		pushChange(ns, e)
+	}
+	return nil
+}
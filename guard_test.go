@@ -0,0 +1,133 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGuard_Refuse(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	defer resetBlocked()
+	setTestConfig("application", map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"})
+	gOption.guards = map[string]*Guard{"application": {MaxDeletePercent: 50, RefuseEmpty: true}}
+	var events []*ErrorEvent
+	RegErrorEventHandler(func(event *ErrorEvent) {
+		events = append(events, event)
+	})
+	defer RegErrorEventHandler(nil)
+
+	ns := &namespace{NamespaceName: "application"}
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: "application", ReleaseKey: "r1"},
+		Configurations: map[string]string{"a": "1", "b": "2"},
+	}
+	assert.Nil(t, checkRelease(ns, cfg, time.Now()))
+
+	cfg.ReleaseKey = "r2"
+	cfg.Configurations = map[string]string{"a": "1", "e": "5"}
+	err := checkRelease(ns, cfg, time.Now())
+	assert.Equal(t, ErrReleaseRefused, errors.Cause(err))
+	// the same release is only reported once
+	assert.NotNil(t, checkRelease(ns, cfg, time.Now()))
+
+	cfg.ReleaseKey = "r3"
+	cfg.Configurations = map[string]string{}
+	assert.Equal(t, ErrReleaseRefused, errors.Cause(checkRelease(ns, cfg, time.Now())))
+
+	assert.Len(t, events, 2)
+	assert.Equal(t, "r2", events[0].ReleaseKey)
+	assert.Contains(t, events[0].Err.Error(), "deletes 3 of 4 keys")
+	assert.Equal(t, "r3", events[1].ReleaseKey)
+	assert.Empty(t, GetHeldReleases())
+	assert.NotNil(t, ConfirmRelease("application", "r3"))
+}
+
+func TestGuard_Hold(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	defer resetBlocked()
+	setTestConfig("application", map[string]string{"a": "1", "b": "2"})
+	gOption.guards = map[string]*Guard{"application": {MaxDeletePercent: 10, Action: GUARD_HOLD}}
+	var changed *ChangeEvent
+	RegChangeEventHandler(func(event *ChangeEvent) error {
+		changed = event
+		return nil
+	})
+	defer RegChangeEventHandler(nil)
+
+	ns := &namespace{NamespaceName: "application"}
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: "application", ReleaseKey: "r1"},
+		Configurations: map[string]string{"a": "1"},
+	}
+	fetchTime := time.Now().Add(-time.Minute)
+	err := checkRelease(ns, cfg, fetchTime)
+	assert.Equal(t, ErrReleaseHeld, errors.Cause(err))
+	held := GetHeldReleases()
+	assert.Len(t, held, 1)
+	assert.Equal(t, "r1", held[0].ReleaseKey)
+
+	b, err := GetConfigReader("application").GetStringValue("b")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", b)
+
+	assert.NotNil(t, ConfirmRelease("application", "r0"))
+	assert.Nil(t, ConfirmRelease("application", "r1"))
+	assert.Empty(t, GetHeldReleases())
+	_, err = GetConfigReader("application").GetStringValue("b")
+	assert.NotNil(t, err)
+	assert.Equal(t, "r1", ns.releaseKey)
+	// backup of confirmed release has its own fetch time
+	dc, err := loadDiskConfig("application")
+	assert.Nil(t, err)
+	assert.True(t, fetchTime.Equal(dc.FetchTime))
+	assert.NotNil(t, changed)
+	assert.Len(t, changed.Changes, 1)
+}
+
+func TestGuard_ConfirmWhileSync(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	defer resetBlocked()
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "application.properties")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("a=1\nb=2\n"), 0644))
+	s := &service{namespaceList: []*namespace{{NamespaceName: "application"}}, local: &localProvider{dir: dir}}
+	assert.Nil(t, s.syncConfig(true, nil))
+	gOption.guards = map[string]*Guard{"application": {MaxDeletePercent: 10, Action: GUARD_HOLD}}
+
+	assert.Nil(t, ioutil.WriteFile(file, []byte("a=1\n"), 0644))
+	assert.Nil(t, s.syncConfig(false, nil))
+	held := GetHeldReleases()
+	assert.Len(t, held, 1)
+
+	// a newer release is applied by sync while the held one is confirmed
+	assert.Nil(t, ioutil.WriteFile(file, []byte("a=1\nb=2\nc=3\n"), 0644))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = ConfirmRelease("application", held[0].ReleaseKey)
+	}()
+	assert.Nil(t, s.syncConfig(false, nil))
+	wg.Wait()
+
+	c, err := GetConfigReader("application").GetStringValue("c")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", c)
+	assert.Empty(t, GetHeldReleases())
+}
+
+func resetBlocked() {
+	gBlockedMutex.Lock()
+	gBlocked = make(map[string]*blockedRelease)
+	gBlockedMutex.Unlock()
+}
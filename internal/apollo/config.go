@@ -35,6 +35,8 @@ type (
 		AppId    string `json:"appId"`
 		Cluster  string `json:"cluster"`
 		ClientIp string `json:"-"`
+		// requests are signed with it if it is set, see access key of apollo
+		AccessKeySecret string `json:"-"`
 	}
 
 	Message struct {
@@ -67,7 +69,9 @@ func (cc *ConfigCenter) SyncConfig(namespaceName, releaseKey string, notificatio
 	cf, err := requestRecovery(
 		cc.Host,
 		&reqConfig{
-			Uri: urlSuffix,
+			Uri:    urlSuffix,
+			AppId:  cc.AppId,
+			Secret: cc.AccessKeySecret,
 		},
 		&CallBack{
 			SuccCallBack: syncSucc,
@@ -83,7 +87,7 @@ func (cc *ConfigCenter) SyncConfig(namespaceName, releaseKey string, notificatio
 
 	if ret != nil {
 		if ret.ReleaseKey == releaseKey {
-			err = errors.New("same config compare with last")
+			err = ErrSameRelease
 		}
 
 		if ret.NamespaceName != namespaceName {
@@ -30,3 +30,6 @@ func NewMutliError() *multierror.Error {
 }
 
 var ErrInvalidHttpStatus = errors.New("invalid http status")
+
+// ErrSameRelease is returned by SyncConfig when apollo returns the release already got
+var ErrSameRelease = errors.New("same config compare with last")
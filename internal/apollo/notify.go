@@ -25,6 +25,8 @@ func (cc *ConfigCenter) PullNotify(notifications string) ([]*NotifyMsg, error) {
 		&reqConfig{
 			Uri:     urlSuffix,
 			Timeout: NofityTimeout,
+			AppId:   cc.AppId,
+			Secret:  cc.AccessKeySecret,
 		},
 		&CallBack{
 			SuccCallBack: notifySucc,
@@ -22,6 +22,9 @@ type reqConfig struct {
 	Timeout time.Duration
 	// apollo config center uri
 	Uri string
+	// access key secret of app, request is not signed if it is empty
+	AppId  string
+	Secret string
 }
 
 func requestRecovery(hostRs Resolver, rc *reqConfig, callBack *CallBack) (interface{}, error) {
@@ -35,7 +38,7 @@ func requestRecovery(hostRs Resolver, rc *reqConfig, callBack *CallBack) (interf
 	}
 	for _, v := range hosts {
 		requestUrl := v + "/" + rc.Uri
-		response, err = request(requestUrl, rc.Timeout, callBack)
+		response, err = request(requestUrl, rc, callBack)
 		if err != nil {
 			logger.LogInfo("request faield, %v, %v", requestUrl, err)
 			retErr = multierror.Append(retErr, err)
@@ -47,11 +50,11 @@ func requestRecovery(hostRs Resolver, rc *reqConfig, callBack *CallBack) (interf
 	return nil, errors.WithMessage(retErr, "all hosts failed")
 }
 
-func request(requestUrl string, timeout time.Duration, callBack *CallBack) (interface{}, error) {
+func request(requestUrl string, rc *reqConfig, callBack *CallBack) (interface{}, error) {
 	client := &http.Client{Timeout: ConnectTimeout}
 	// if has custom timeout setting
-	if timeout != 0 {
-		client.Timeout = timeout
+	if rc.Timeout != 0 {
+		client.Timeout = rc.Timeout
 	}
 
 	var resBody []byte
@@ -64,7 +67,7 @@ func request(requestUrl string, timeout time.Duration, callBack *CallBack) (inte
 			time.Sleep(waitTs)
 			waitTs += RetryInterval
 		}
-		res, err = client.Get(requestUrl)
+		res, err = get(client, requestUrl, rc)
 		if res == nil || err != nil {
 			logger.LogError("Connect Apollo Server Fail,Error: %v waitTs %s", err, waitTs)
 			retErr = multierror.Append(retErr, err)
@@ -111,3 +114,15 @@ func request(requestUrl string, timeout time.Duration, callBack *CallBack) (inte
 	}
 	return nil, nil
 }
+
+func get(client *http.Client, requestUrl string, rc *reqConfig) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rc.Secret != "" {
+		// timestamp is in the signature, so it is signed again on retry
+		signRequest(req, rc.AppId, rc.Secret)
+	}
+	return client.Do(req)
+}
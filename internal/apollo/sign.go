@@ -0,0 +1,38 @@
+package apollo
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// headers of access key authentication of apollo
+const (
+	AuthorizationHeader = "Authorization"
+	TimestampHeader     = "Timestamp"
+)
+
+// signRequest sets headers of access key authentication,
+// signature is base64 of HMAC-SHA1 of timestamp in milliseconds and path with query, joined by new line
+func signRequest(req *http.Request, appId, secret string) {
+	timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	req.Header.Set(AuthorizationHeader, "Apollo "+appId+":"+Signature(timestamp, pathWithQuery(req), secret))
+	req.Header.Set(TimestampHeader, timestamp)
+}
+
+// Signature returns signature of request by access key secret
+func Signature(timestamp, pathWithQuery, secret string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + pathWithQuery))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func pathWithQuery(req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return req.URL.EscapedPath()
+	}
+	return req.URL.EscapedPath() + "?" + req.URL.RawQuery
+}
@@ -0,0 +1,214 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	placeholderPrefix = "${"
+	placeholderSuffix = "}"
+	// separator of placeholder name and its default value
+	placeholderDefaultSep = ":"
+)
+
+var (
+	// configurations of namespaces before interpolation, only kept when interpolation is enabled
+	gRaw      = make(map[string]map[string]string)
+	gRawMutex sync.Mutex
+)
+
+// effectiveConfigurations returns configurations of release as they are put in cache, decoded and interpolated
+func effectiveConfigurations(ac *apollo.Config) map[string]string {
+	configurations := decodeConfigurations(ac.NamespaceName, ac.Configurations)
+	if !interpolationEnabled() {
+		return configurations
+	}
+	gRawMutex.Lock()
+	defer gRawMutex.Unlock()
+	return interpolate(ac.NamespaceName, configurations)
+}
+
+func interpolationEnabled() bool {
+	return gOption != nil && gOption.interpolation
+}
+
+// interpolate resolves placeholders in configurations of namespace against the other namespaces in gRaw,
+// gRawMutex must be held
+func interpolate(namespaceName string, configurations map[string]string) map[string]string {
+	raw := make(map[string]map[string]string, len(gRaw)+1)
+	for ns, c := range gRaw {
+		raw[ns] = c
+	}
+	raw[namespaceName] = configurations
+
+	in := &interpolator{raw: raw}
+	ret := make(map[string]string, len(configurations))
+	for k, v := range configurations {
+		if strings.Contains(v, placeholderPrefix) {
+			v, _ = in.resolve(namespaceName, k)
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// setRaw keeps configurations of namespace for interpolation and re-resolves the namespaces depending on it,
+// cache of the dependent namespaces is updated and their change events are returned.
+func setRaw(ac *apollo.Config) []*ChangeEvent {
+	if !interpolationEnabled() {
+		return nil
+	}
+	gRawMutex.Lock()
+	gRaw[ac.NamespaceName] = decodeConfigurations(ac.NamespaceName, ac.Configurations)
+	others := make([]string, 0, len(gRaw))
+	for ns := range gRaw {
+		if ns != ac.NamespaceName && hasPlaceholder(gRaw[ns]) {
+			others = append(others, ns)
+		}
+	}
+	sort.Strings(others)
+
+	var events []*ChangeEvent
+	for _, ns := range others {
+		event := getConfigurationsChangeEvent(ns, interpolate(ns, gRaw[ns]))
+		if len(event.Changes) > 0 {
+			events = append(events, event)
+		}
+	}
+	gRawMutex.Unlock()
+
+	effective := make([]*ChangeEvent, 0, len(events))
+	for _, event := range events {
+		effective = append(effective, updateRemote(event))
+	}
+	return effective
+}
+
+func hasPlaceholder(configurations map[string]string) bool {
+	for _, v := range configurations {
+		if strings.Contains(v, placeholderPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// interpolator resolves ${name} and ${name:default} placeholders, name is looked up as
+// a key of the same namespace, a key of another namespace prefixed with namespace name and SEP,
+// then an environment variable. placeholder can not be resolved is kept as it is.
+type interpolator struct {
+	raw map[string]map[string]string
+	// keys being resolved, to detect cycle
+	stack []string
+}
+
+// resolve returns value of key in namespace with placeholders resolved, false if key is not found or in a cycle
+func (in *interpolator) resolve(namespaceName, key string) (string, bool) {
+	v, ok := in.raw[namespaceName][key]
+	if !ok {
+		return "", false
+	}
+	id := namespaceName + SEP + key
+	for i, s := range in.stack {
+		if s == id {
+			logger.LogError("placeholder cycle: %s -> %s", strings.Join(in.stack[i:], " -> "), id)
+			return "", false
+		}
+	}
+	in.stack = append(in.stack, id)
+	defer func() {
+		in.stack = in.stack[:len(in.stack)-1]
+	}()
+	return in.expand(namespaceName, v), true
+}
+
+func (in *interpolator) expand(namespaceName, s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, placeholderPrefix)
+		if start < 0 {
+			break
+		}
+		end := placeholderEnd(s, start+len(placeholderPrefix))
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		b.WriteString(in.placeholder(namespaceName, s[start:end+1], s[start+len(placeholderPrefix):end]))
+		s = s[end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func (in *interpolator) placeholder(namespaceName, placeholder, expr string) string {
+	name, def, hasDef := expr, "", false
+	if idx := placeholderDefaultIndex(expr); idx >= 0 {
+		name, def, hasDef = expr[:idx], expr[idx+len(placeholderDefaultSep):], true
+	}
+	if v, ok := in.lookup(namespaceName, name); ok {
+		return v
+	}
+	if hasDef {
+		return in.expand(namespaceName, def)
+	}
+	logger.LogError("placeholder %s in namespace %s can not be resolved", placeholder, namespaceName)
+	return placeholder
+}
+
+func (in *interpolator) lookup(namespaceName, name string) (string, bool) {
+	if v, ok := in.resolve(namespaceName, name); ok {
+		return v, true
+	}
+	// the longest namespace name matches, namespace name may contain SEP
+	other := ""
+	for ns := range in.raw {
+		if ns != namespaceName && len(ns) > len(other) && strings.HasPrefix(name, ns+SEP) {
+			other = ns
+		}
+	}
+	if other != "" {
+		if v, ok := in.resolve(other, name[len(other)+len(SEP):]); ok {
+			return v, true
+		}
+	}
+	return os.LookupEnv(name)
+}
+
+// placeholderEnd returns index of suffix matching the prefix before i, nested placeholders are skipped
+func placeholderEnd(s string, i int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], placeholderPrefix) {
+			depth++
+			i += len(placeholderPrefix) - 1
+		} else if strings.HasPrefix(s[i:], placeholderSuffix) {
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// placeholderDefaultIndex returns index of the default separator not in a nested placeholder
+func placeholderDefaultIndex(expr string) int {
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		if strings.HasPrefix(expr[i:], placeholderPrefix) {
+			depth++
+			i += len(placeholderPrefix) - 1
+		} else if strings.HasPrefix(expr[i:], placeholderSuffix) {
+			depth--
+		} else if depth == 0 && strings.HasPrefix(expr[i:], placeholderDefaultSep) {
+			return i
+		}
+	}
+	return -1
+}
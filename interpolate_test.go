@@ -0,0 +1,106 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func useTestInterpolation() func() {
+	restore := useTestBackupStore(NewMemoryBackupStore())
+	gOption.interpolation = true
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	return func() {
+		gRawMutex.Lock()
+		gRaw = make(map[string]map[string]string)
+		gRawMutex.Unlock()
+		restore()
+	}
+}
+
+func newTestRelease(namespaceName string, configurations map[string]string) (*apollo.Config, *ChangeEvent, []*ChangeEvent) {
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: namespaceName},
+		Configurations: configurations,
+	}
+	events := updateMemoryCache(cfg, &namespace{NamespaceName: namespaceName}, getChangeEvent(cfg))
+	return cfg, events[0], events[1:]
+}
+
+func TestInterpolate_Resolve(t *testing.T) {
+	defer useTestInterpolation()()
+	os.Setenv("AGOLLO_TEST_ENV", "env")
+	defer os.Unsetenv("AGOLLO_TEST_ENV")
+
+	newTestRelease("common.apollo", map[string]string{"region": "sg"})
+	newTestRelease("application", map[string]string{
+		"db.host":  "localhost",
+		"db.port":  "3306",
+		"url":      "jdbc:mysql://${db.host}:${db.port}/app",
+		"region":   "${common.apollo.region}",
+		"env":      "${AGOLLO_TEST_ENV}",
+		"def":      "${missing:${db.port}}",
+		"empty":    "${missing:}",
+		"unknown":  "${missing}",
+		"cycle.a":  "${cycle.b}",
+		"cycle.b":  "${cycle.a:b}",
+		"self":     "${self}",
+		"unclosed": "${db.host",
+	})
+
+	cr := GetConfigReader("application")
+	for k, expected := range map[string]string{
+		"url":      "jdbc:mysql://localhost:3306/app",
+		"region":   "sg",
+		"env":      "env",
+		"def":      "3306",
+		"empty":    "",
+		"unknown":  "${missing}",
+		"cycle.a":  "b",
+		"self":     "${self}",
+		"unclosed": "${db.host",
+	} {
+		v, err := cr.GetStringValue(k)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, v, k)
+	}
+}
+
+func TestInterpolate_Dependents(t *testing.T) {
+	defer useTestInterpolation()()
+
+	newTestRelease("common", map[string]string{"region": "sg", "zone": "a"})
+	newTestRelease("application", map[string]string{
+		"host":   "${common.region}-${zone}.example.com",
+		"zone":   "${common.zone}",
+		"static": "x",
+	})
+	host, _ := GetConfigReader("application").GetStringValue("host")
+	assert.Equal(t, "sg-a.example.com", host)
+
+	_, event, dependents := newTestRelease("common", map[string]string{"region": "us", "zone": "a"})
+	assert.Len(t, event.Changes, 1)
+	assert.Len(t, dependents, 1)
+	assert.Equal(t, "application", dependents[0].Namespace)
+	assert.Equal(t, []*ConfigChange{newModifyConfigChange("host", "sg-a.example.com", "us-a.example.com")}, dependents[0].Changes)
+	host, _ = GetConfigReader("application").GetStringValue("host")
+	assert.Equal(t, "us-a.example.com", host)
+
+	// raw value referencing an existing key is reported as the resolved value
+	_, event, _ = newTestRelease("application", map[string]string{
+		"host":   "${common.region}-${zone}.example.com",
+		"zone":   "b",
+		"static": "x",
+	})
+	changes := make(map[string]string)
+	for _, c := range event.Changes {
+		changes[c.Key] = c.NewValue
+	}
+	assert.Equal(t, map[string]string{"host": "us-b.example.com", "zone": "b"}, changes)
+
+	events := make(map[string]*ChangeEvent)
+	mergeChangeEvent(events, &ChangeEvent{Namespace: "application", Changes: []*ConfigChange{newAddConfigChange("a", "1")}})
+	mergeChangeEvent(events, &ChangeEvent{Namespace: "application", Changes: []*ConfigChange{newAddConfigChange("b", "2")}})
+	assert.Len(t, events["application"].Changes, 2)
+}
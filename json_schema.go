@@ -0,0 +1,228 @@
+package agollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// jsonSchema is a subset of JSON Schema, unknown keywords are ignored
+type jsonSchema struct {
+	Type                 []string               `json:"-"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"-"`
+	// additionalProperties is false
+	NoAdditionalProperties bool        `json:"-"`
+	Items                  *jsonSchema `json:"items"`
+	Minimum                *float64    `json:"minimum"`
+	Maximum                *float64    `json:"maximum"`
+	ExclusiveMinimum       *float64    `json:"exclusiveMinimum"`
+	ExclusiveMaximum       *float64    `json:"exclusiveMaximum"`
+	MinLength              *int        `json:"minLength"`
+	MaxLength              *int        `json:"maxLength"`
+	Pattern                string      `json:"pattern"`
+	MinItems               *int        `json:"minItems"`
+	MaxItems               *int        `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+func parseJsonSchema(data []byte) (*jsonSchema, error) {
+	js := &jsonSchema{}
+	if err := json.Unmarshal(data, js); err != nil {
+		return nil, err
+	}
+	return js, nil
+}
+
+func (js *jsonSchema) UnmarshalJSON(data []byte) error {
+	type plain jsonSchema
+	var raw struct {
+		*plain
+		Type                 json.RawMessage `json:"type"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	raw.plain = (*plain)(js)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	// type is a string or an array of string
+	if len(raw.Type) > 0 {
+		var t string
+		if err := json.Unmarshal(raw.Type, &t); err == nil {
+			js.Type = []string{t}
+		} else if err = json.Unmarshal(raw.Type, &js.Type); err != nil {
+			return errors.WithMessage(err, "type")
+		}
+	}
+	// additionalProperties is a bool or a schema
+	if len(raw.AdditionalProperties) > 0 {
+		var b bool
+		if err := json.Unmarshal(raw.AdditionalProperties, &b); err == nil {
+			js.NoAdditionalProperties = !b
+		} else {
+			js.AdditionalProperties = &jsonSchema{}
+			if err = json.Unmarshal(raw.AdditionalProperties, js.AdditionalProperties); err != nil {
+				return errors.WithMessage(err, "additionalProperties")
+			}
+		}
+	}
+	if js.Pattern != "" {
+		var err error
+		if js.pattern, err = regexp.Compile(js.Pattern); err != nil {
+			return errors.WithMessage(err, "pattern")
+		}
+	}
+	return nil
+}
+
+// validateContent decodes content of json or yaml namespace and validates it
+func validateContent(js *jsonSchema, namespaceName, content string) error {
+	var v interface{}
+	switch namespaceFormat(namespaceName) {
+	case FORMAT_YAML, FORMAT_YML:
+		if err := yaml.Unmarshal([]byte(content), &v); err != nil {
+			return errors.WithMessage(err, "yaml Unmarshal")
+		}
+		// yaml numbers are int or float64, validated as json numbers
+		b, err := json.Marshal(toJsonValue(v))
+		if err != nil {
+			return errors.WithMessage(err, "json Marshal")
+		}
+		content = string(b)
+	}
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return errors.WithMessage(err, "json Unmarshal")
+	}
+	return js.validate("$", v)
+}
+
+func (js *jsonSchema) validate(path string, v interface{}) error {
+	if len(js.Type) > 0 {
+		matched := false
+		for _, t := range js.Type {
+			if jsonTypeMatch(t, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.New(fmt.Sprintf("%s: type is not %v", path, js.Type))
+		}
+	}
+	if len(js.Enum) > 0 {
+		matched := false
+		for _, e := range js.Enum {
+			if reflect.DeepEqual(e, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.New(fmt.Sprintf("%s: not in enum %v", path, js.Enum))
+		}
+	}
+
+	switch t := v.(type) {
+	case float64:
+		if js.Minimum != nil && t < *js.Minimum {
+			return errors.New(fmt.Sprintf("%s: less than minimum %v", path, *js.Minimum))
+		}
+		if js.Maximum != nil && t > *js.Maximum {
+			return errors.New(fmt.Sprintf("%s: greater than maximum %v", path, *js.Maximum))
+		}
+		if js.ExclusiveMinimum != nil && t <= *js.ExclusiveMinimum {
+			return errors.New(fmt.Sprintf("%s: not greater than exclusiveMinimum %v", path, *js.ExclusiveMinimum))
+		}
+		if js.ExclusiveMaximum != nil && t >= *js.ExclusiveMaximum {
+			return errors.New(fmt.Sprintf("%s: not less than exclusiveMaximum %v", path, *js.ExclusiveMaximum))
+		}
+	case string:
+		n := utf8.RuneCountInString(t)
+		if js.MinLength != nil && n < *js.MinLength {
+			return errors.New(fmt.Sprintf("%s: shorter than minLength %d", path, *js.MinLength))
+		}
+		if js.MaxLength != nil && n > *js.MaxLength {
+			return errors.New(fmt.Sprintf("%s: longer than maxLength %d", path, *js.MaxLength))
+		}
+		if js.pattern != nil && !js.pattern.MatchString(t) {
+			return errors.New(fmt.Sprintf("%s: not match pattern %s", path, js.Pattern))
+		}
+	case []interface{}:
+		if js.MinItems != nil && len(t) < *js.MinItems {
+			return errors.New(fmt.Sprintf("%s: fewer than minItems %d", path, *js.MinItems))
+		}
+		if js.MaxItems != nil && len(t) > *js.MaxItems {
+			return errors.New(fmt.Sprintf("%s: more than maxItems %d", path, *js.MaxItems))
+		}
+		if js.Items != nil {
+			for i, item := range t {
+				if err := js.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, k := range js.Required {
+			if _, ok := t[k]; !ok {
+				return errors.New(fmt.Sprintf("%s: required property %s is missing", path, k))
+			}
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := js.Properties[k]
+			if child == nil {
+				if js.NoAdditionalProperties {
+					return errors.New(fmt.Sprintf("%s: additional property %s is not allowed", path, k))
+				}
+				child = js.AdditionalProperties
+			}
+			if child == nil {
+				continue
+			}
+			if err := child.validate(path+SEP+k, t[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatch(t string, v interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return false
+}
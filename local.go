@@ -0,0 +1,207 @@
+package agollo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// suffix of file of properties namespace in local dir
+const propertiesSuffix = "." + FORMAT_PROPERTIES
+
+// localProvider reads namespaces from files in dir instead of apollo, file of a namespace with format suffix,
+// like db.yaml, has the same name and is put in content key, the others are read from name.properties.
+// a missing file is an empty namespace, so a file added later is loaded too.
+type localProvider struct {
+	dir string
+}
+
+// fileName returns name of file of namespace in dir, properties is true if it is a properties file
+func (p *localProvider) fileName(namespaceName string) (name string, properties bool) {
+	if namespaceFormat(namespaceName) == FORMAT_PROPERTIES {
+		return namespaceName + propertiesSuffix, true
+	}
+	return namespaceName, false
+}
+
+// check is called at Init, dir must exist, and a missing file of namespace is logged,
+// as it is likely a wrong dir or name rather than an empty namespace
+func (p *localProvider) check(namespaces []*namespace) error {
+	fi, err := os.Stat(p.dir)
+	if err != nil {
+		return errors.WithMessage(err, "local dir")
+	}
+	if !fi.IsDir() {
+		return errors.New("local dir " + p.dir + " is not a dir")
+	}
+	var missing []string
+	for _, v := range namespaces {
+		name, _ := p.fileName(v.NamespaceName)
+		if _, err = os.Stat(filepath.Join(p.dir, name)); os.IsNotExist(err) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == len(namespaces) {
+		logger.LogError("no file of namespaces is found in local dir %s", p.dir)
+	} else if len(missing) > 0 {
+		logger.LogError("files %v are not found in local dir %s, they are empty namespaces", missing, p.dir)
+	}
+	return nil
+}
+
+// SyncConfig reads file of namespace, release key is checksum of the file, nil is returned if it is not changed
+func (p *localProvider) SyncConfig(namespaceName, releaseKey string) (*apollo.Config, error) {
+	name, properties := p.fileName(namespaceName)
+	data, err := ioutil.ReadFile(filepath.Join(p.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithMessage(err, "ReadFile")
+	}
+
+	sum := sha256.Sum256(data)
+	rk := "local-" + hex.EncodeToString(sum[:8])
+	if rk == releaseKey {
+		return nil, nil
+	}
+
+	cfg := &apollo.Config{
+		ConnConfig: apollo.ConnConfig{
+			AppId:         gOption.AppId,
+			Cluster:       gOption.Cluster,
+			NamespaceName: namespaceName,
+			ReleaseKey:    rk,
+		},
+		Configurations: make(map[string]string),
+	}
+	if properties {
+		if cfg.Configurations, err = parseProperties(data); err != nil {
+			return nil, errors.WithMessage(err, "parse "+name)
+		}
+	} else if len(data) > 0 {
+		cfg.Configurations[contentKey] = string(data)
+	}
+	return cfg, nil
+}
+
+// parseProperties parses java properties, key and value are separated by =, : or space,
+// # and ! start a comment, line ending with \ continues on the next line
+func parseProperties(data []byte) (map[string]string, error) {
+	ret := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	var logical strings.Builder
+	for sc.Scan() {
+		line := strings.TrimLeft(sc.Text(), " \t\f")
+		if logical.Len() == 0 && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		if continued(line) {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+		key, value, err := splitProperty(logical.String())
+		if err != nil {
+			return nil, err
+		}
+		ret[key] = value
+		logical.Reset()
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if logical.Len() > 0 {
+		key, value, err := splitProperty(logical.String())
+		if err != nil {
+			return nil, err
+		}
+		ret[key] = value
+	}
+	return ret, nil
+}
+
+// continued reports whether line ends with an odd number of \
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func splitProperty(line string) (string, string, error) {
+	i := 0
+	for ; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '=' || line[i] == ':' || line[i] == ' ' || line[i] == '\t' {
+			break
+		}
+	}
+	if i > len(line) {
+		// line ends with an escaping \
+		i = len(line)
+	}
+	rawKey := line[:i]
+	rest := strings.TrimLeft(line[i:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	key, err := unescapeProperty(rawKey)
+	if err != nil {
+		return "", "", errors.WithMessage(err, "key "+rawKey)
+	}
+	value, err := unescapeProperty(rest)
+	if err != nil {
+		return "", "", errors.WithMessage(err, "value of "+key)
+	}
+	return key, value, nil
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i == len(s)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", errors.New("malformed \\u escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", errors.New("malformed \\u escape")
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
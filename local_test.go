@@ -0,0 +1,92 @@
+package agollo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocal_parseProperties(t *testing.T) {
+	props, err := parseProperties([]byte(`# comment
+! comment
+a=1
+b : 2
+c 3
+  d = x \
+      y
+e\=f=gA\t
+empty
+url=http://host:8080/path
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"a":     "1",
+		"b":     "2",
+		"c":     "3",
+		"d":     "x y",
+		"e=f":   "gA\t",
+		"empty": "",
+		"url":   "http://host:8080/path",
+	}, props)
+
+	_, err = parseProperties([]byte(`a=\u00`))
+	assert.NotNil(t, err)
+}
+
+func TestLocal_SyncConfig(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "application.properties"), []byte("timeout=1s\nretry=3\n"), 0644))
+
+	s := &service{
+		namespaceList: []*namespace{{NamespaceName: "application"}, {NamespaceName: "db.yaml"}},
+		local:         &localProvider{dir: dir},
+	}
+	assert.Nil(t, s.syncConfig(true, nil))
+	cr := GetConfigReader("application")
+	v, _ := cr.GetStringValue("timeout")
+	assert.Equal(t, "1s", v)
+	assert.Empty(t, GetConfigReader("db.yaml").GetAll())
+
+	var events []*ChangeEvent
+	RegChangeEventHandler(func(event *ChangeEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	defer RegChangeEventHandler(nil)
+
+	// nothing changed
+	assert.Nil(t, s.syncConfig(false, nil))
+	assert.Empty(t, events)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "application.properties"), []byte("timeout=2s\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "db.yaml"), []byte("host: localhost\n"), 0644))
+	assert.Nil(t, s.syncConfig(false, nil))
+	assert.Len(t, events, 2)
+	assert.Equal(t, []*ConfigChange{
+		newModifyConfigChange("timeout", "1s", "2s"),
+		newDeletedConfigChange("retry", "3"),
+	}, sortChanges(events[0]).Changes)
+	v, _ = GetConfigReader("db.yaml").GetStringValue("host")
+	assert.Equal(t, "localhost", v)
+	assert.Contains(t, GetConfigReader("db.yaml").GetReleaseKey(), "local-")
+}
+
+func TestLocal_check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	namespaces := []*namespace{{NamespaceName: "application"}, {NamespaceName: "db.yaml"}}
+
+	assert.NotNil(t, (&localProvider{dir: filepath.Join(dir, "missing")}).check(namespaces))
+	file := filepath.Join(dir, "application.properties")
+	assert.Nil(t, ioutil.WriteFile(file, []byte("a=1\n"), 0644))
+	assert.NotNil(t, (&localProvider{dir: file}).check(namespaces))
+	// missing file of namespace is only logged
+	assert.Nil(t, (&localProvider{dir: dir}).check(namespaces))
+}
@@ -18,7 +18,7 @@ var (
 	bkInitOnce  sync.Once
 	bkStartOnce sync.Once
 	bkService   *service
-	bkDefault   map[string]defaultVal
+	bkDefault   map[string]map[string]defaultVal
 	bkCallback  CHandler
 )
 
@@ -0,0 +1,145 @@
+package agollo
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// configurations of each namespace when IgnoreNameSpace is set, cache only keeps the winning values
+	gMerged      = make(map[string]map[string]string)
+	gMergedMutex sync.Mutex
+)
+
+// mergeRank returns precedence of namespace in merged view, lower wins,
+// namespaces are ranked by their order in NamespaceName, the others come after them
+func mergeRank(namespaceName string) int {
+	if gOption != nil {
+		for i, ns := range strings.Split(gOption.NamespaceName, ",") {
+			if ns == namespaceName {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// mergedNamespaces returns namespaces in gMerged by precedence, gMergedMutex must be held
+func mergedNamespaces() []string {
+	names := make([]string, 0, len(gMerged))
+	for ns := range gMerged {
+		names = append(names, ns)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := mergeRank(names[i]), mergeRank(names[j])
+		if ri != rj {
+			// unlisted namespaces, ranked -1, come last
+			return rj < 0 || (ri >= 0 && ri < rj)
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// mergedValue returns the winning value of key and its namespace, gMergedMutex must be held
+func mergedValue(key string) (string, string, bool) {
+	for _, ns := range mergedNamespaces() {
+		if v, ok := gMerged[ns][key]; ok {
+			return v, ns, true
+		}
+	}
+	return EMPTY, EMPTY, false
+}
+
+// getMergedChanges compares configurations with the ones of namespace in merged view
+func getMergedChanges(namespaceName string, configurations map[string]string) []*ConfigChange {
+	gMergedMutex.Lock()
+	defer gMergedMutex.Unlock()
+	old := gMerged[namespaceName]
+	if len(configurations) == 0 && len(old) == 0 {
+		return nil
+	}
+
+	changes := make([]*ConfigChange, 0)
+	for k, v := range configurations {
+		if ov, ok := old[k]; !ok {
+			changes = append(changes, newAddConfigChange(k, v))
+		} else if ov != v {
+			changes = append(changes, newModifyConfigChange(k, ov, v))
+		}
+	}
+	for k, v := range old {
+		if _, ok := configurations[k]; !ok {
+			changes = append(changes, newDeletedConfigChange(k, v))
+		}
+	}
+	return changes
+}
+
+// updateMergedCache applies changes of a namespace to merged view and puts the winning values in cache,
+// changes of winning values are returned, a change shadowed by a namespace with higher precedence is dropped,
+// a deleted key falls back to the namespace with next precedence.
+func updateMergedCache(event *ChangeEvent) *ChangeEvent {
+	gMergedMutex.Lock()
+	defer gMergedMutex.Unlock()
+
+	ret := &ChangeEvent{Namespace: event.Namespace, Changes: make([]*ConfigChange, 0, len(event.Changes))}
+	for _, c := range event.Changes {
+		oldValue, _, hasOld := mergedValue(c.Key)
+		kv, ok := gMerged[event.Namespace]
+		if !ok {
+			kv = make(map[string]string)
+			gMerged[event.Namespace] = kv
+		}
+		if c.ChangeType == DELETED {
+			delete(kv, c.Key)
+		} else {
+			kv[c.Key] = c.NewValue
+		}
+		newValue, winner, hasNew := mergedValue(c.Key)
+
+		cacheMutex.Lock()
+		if hasNew {
+			gConfigCache.Set([]byte(c.Key), &element{Val: newValue, NameSpace: winner}, 0)
+		} else {
+			gConfigCache.Del([]byte(c.Key))
+		}
+		cacheMutex.Unlock()
+
+		switch {
+		case !hasOld:
+			ret.Changes = append(ret.Changes, newAddConfigChange(c.Key, newValue))
+		case !hasNew:
+			ret.Changes = append(ret.Changes, newDeletedConfigChange(c.Key, oldValue))
+		case oldValue != newValue:
+			ret.Changes = append(ret.Changes, newModifyConfigChange(c.Key, oldValue, newValue))
+		}
+	}
+	return ret
+}
+
+// getMergedShadowed returns values of key shadowed by the winning namespace, by precedence
+func getMergedShadowed(key string) []ShadowedValue {
+	gMergedMutex.Lock()
+	defer gMergedMutex.Unlock()
+	var ret []ShadowedValue
+	found := false
+	for _, ns := range mergedNamespaces() {
+		v, ok := gMerged[ns][key]
+		if !ok {
+			continue
+		}
+		if found {
+			ret = append(ret, ShadowedValue{Source: remoteSourceName + ":" + ns, Value: v})
+		}
+		found = true
+	}
+	return ret
+}
+
+func resetMerged() {
+	gMergedMutex.Lock()
+	gMerged = make(map[string]map[string]string)
+	gMergedMutex.Unlock()
+}
@@ -0,0 +1,56 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMerge_Precedence(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	gOption.NamespaceName = "application,common"
+	initCache(DEFAULT_CONFIGCACHESIZE, true)
+	defer initCache(DEFAULT_CONFIGCACHESIZE, false)
+
+	release := func(namespaceName string, configurations map[string]string) []*ChangeEvent {
+		cfg := &apollo.Config{
+			ConnConfig:     apollo.ConnConfig{NamespaceName: namespaceName},
+			Configurations: configurations,
+		}
+		return updateCache(cfg, &namespace{NamespaceName: namespaceName}, getChangeEvent(cfg))
+	}
+
+	release("other", map[string]string{"timeout": "3s", "other": "x"})
+	// common wins over namespace not listed
+	events := release("common", map[string]string{"timeout": "2s", "db.host": "common-host"})
+	assert.Equal(t, []*ConfigChange{newModifyConfigChange("timeout", "3s", "2s")}, effectiveChanges(events, "timeout"))
+	// application wins over common, a change of common shadowed by it is dropped
+	release("application", map[string]string{"timeout": "1s"})
+	events = release("common", map[string]string{"timeout": "5s", "db.host": "common-host"})
+	assert.Empty(t, events[0].Changes)
+
+	v, _ := GetConfigReader("other").GetStringValue("timeout")
+	assert.Equal(t, "1s", v)
+	ex := Explain("application", "timeout")
+	assert.Equal(t, []ShadowedValue{{Source: "remote:common", Value: "5s"}, {Source: "remote:other", Value: "3s"}}, ex.Shadowed)
+
+	// removed key falls back to the next namespace, deleted keys are reported by user key
+	events = release("application", map[string]string{})
+	assert.Equal(t, []*ConfigChange{newModifyConfigChange("timeout", "1s", "5s")}, events[0].Changes)
+	events = release("common", map[string]string{"timeout": "5s"})
+	assert.Equal(t, []*ConfigChange{newDeletedConfigChange("db.host", "common-host")}, events[0].Changes)
+	_, err := GetConfigReader("application").GetStringValue("db.host")
+	assert.NotNil(t, err)
+}
+
+func effectiveChanges(events []*ChangeEvent, key string) []*ConfigChange {
+	var ret []*ConfigChange
+	for _, e := range events {
+		for _, c := range e.Changes {
+			if c.Key == key {
+				ret = append(ret, c)
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,111 @@
+package agollo
+
+import (
+	"encoding/json"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// key of the whole content in namespace of json, yaml, xml or txt format
+const contentKey = "content"
+
+// Object holds a T decoded from content of a json or yaml namespace,
+// it is decoded again on every release, and the previous one is kept if decoding fails.
+type Object[T any] struct {
+	namespace  string
+	listenerId int64
+	v          atomic.Value
+
+	mu       sync.Mutex
+	onUpdate func(old, new *T)
+}
+
+// RegisterObject decodes content of namespace to T, by yaml if namespace name ends with .yaml or .yml,
+// otherwise by json. init is held until the namespace has content.
+//    obj, err := RegisterObject("test.json", &TestConfig{})
+//    cfg := obj.Load()
+func RegisterObject[T any](namespaceName string, init *T) (*Object[T], error) {
+	if init == nil {
+		init = new(T)
+	}
+	o := &Object[T]{namespace: namespaceName}
+	o.v.Store(init)
+
+	content, err := GetConfigReader(namespaceName).GetBytesValue(contentKey)
+	if err == nil {
+		obj, err := o.decode(content)
+		if err != nil {
+			return nil, err
+		}
+		o.v.Store(obj)
+	}
+	o.listenerId = addChangeListener(o.onChange)
+	return o, nil
+}
+
+// Load returns the latest object, it must not be modified
+func (o *Object[T]) Load() *T {
+	return o.v.Load().(*T)
+}
+
+// OnUpdate sets fn to be called after the object is replaced by a new release
+func (o *Object[T]) OnUpdate(fn func(old, new *T)) {
+	o.mu.Lock()
+	o.onUpdate = fn
+	o.mu.Unlock()
+}
+
+// Close stops decoding new releases
+func (o *Object[T]) Close() {
+	removeChangeListener(o.listenerId)
+}
+
+func (o *Object[T]) onChange(event *ChangeEvent) {
+	if event.Namespace != o.namespace {
+		return
+	}
+	for _, c := range event.Changes {
+		if c.Key != contentKey || c.ChangeType == DELETED {
+			continue
+		}
+		// value in event may be encrypted
+		content, err := GetConfigReader(o.namespace).GetBytesValue(contentKey)
+		if err != nil {
+			logger.LogError("get content of %s fail, keep the previous object: %v", o.namespace, err)
+			return
+		}
+		obj, err := o.decode(content)
+		if err != nil {
+			logger.LogError("decode content of %s fail, keep the previous object: %v", o.namespace, err)
+			return
+		}
+		old := o.Load()
+		o.v.Store(obj)
+
+		o.mu.Lock()
+		fn := o.onUpdate
+		o.mu.Unlock()
+		if fn != nil {
+			fn(old, obj)
+		}
+		return
+	}
+}
+
+func (o *Object[T]) decode(content []byte) (*T, error) {
+	obj := new(T)
+	var err error
+	if strings.HasSuffix(o.namespace, ".yaml") || strings.HasSuffix(o.namespace, ".yml") {
+		err = yaml.Unmarshal(content, obj)
+	} else {
+		err = json.Unmarshal(content, obj)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode content of "+o.namespace)
+	}
+	return obj, nil
+}
@@ -0,0 +1,60 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testObject struct {
+	Test  string `json:"test" yaml:"test"`
+	Test2 int    `json:"test2" yaml:"test2"`
+}
+
+func TestObject_DecodeOnRelease(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	setTestConfig("test.json", map[string]string{
+		"content": `{"test":"a","test2":1}`,
+	})
+
+	obj, err := RegisterObject("test.json", &testObject{})
+	assert.Nil(t, err)
+	defer obj.Close()
+	assert.Equal(t, &testObject{Test: "a", Test2: 1}, obj.Load())
+
+	var updated [2]*testObject
+	obj.OnUpdate(func(old, new *testObject) {
+		updated = [2]*testObject{old, new}
+	})
+
+	ns := &namespace{NamespaceName: "test.json"}
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: "test.json"},
+		Configurations: map[string]string{"content": `{"test":"b","test2":2}`},
+	}
+	updateCache(cfg, ns, getChangeEvent(cfg))
+	assert.Equal(t, &testObject{Test: "b", Test2: 2}, obj.Load())
+	assert.Equal(t, [2]*testObject{{Test: "a", Test2: 1}, {Test: "b", Test2: 2}}, updated)
+
+	// broken release keeps the previous object
+	cfg.Configurations = map[string]string{"content": `{"test":`}
+	updateCache(cfg, ns, getChangeEvent(cfg))
+	assert.Equal(t, &testObject{Test: "b", Test2: 2}, obj.Load())
+}
+
+func TestObject_Yaml(t *testing.T) {
+	setTestConfig("app.yaml", map[string]string{
+		"content": "test: a\ntest2: 3\n",
+	})
+
+	obj, err := RegisterObject("app.yaml", &testObject{})
+	assert.Nil(t, err)
+	defer obj.Close()
+	assert.Equal(t, &testObject{Test: "a", Test2: 3}, obj.Load())
+
+	init := &testObject{Test: "init"}
+	obj2, err := RegisterObject("missing.json", init)
+	assert.Nil(t, err)
+	defer obj2.Close()
+	assert.Equal(t, init, obj2.Load())
+}
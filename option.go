@@ -1,11 +1,8 @@
 package agollo
 
 import (
-	"encoding/json"
-	"fmt"
 	"github.com/Shonminh/apollo-client/internal/logger"
-	"github.com/pkg/errors"
-	"io/ioutil"
+	"io/fs"
 	"time"
 )
 
@@ -38,19 +35,24 @@ var (
 )
 
 type option struct {
-	AppId           string `json:"appId"`
-	Cluster         string `json:"cluster"`
-	NamespaceName   string `json:"namespaceName"`
-	ApolloAddr      string `json:"apolloAddr"`
-	BackupDir       string `json:"backupDir"`
-	BackupSuffix    string `json:"backupSuffix"`
-	ConfigCacheSize int    `json:"configCacheSize"`
-
-	confFile         string
+	AppId           string `json:"appId" yaml:"appId"`
+	Cluster         string `json:"cluster" yaml:"cluster"`
+	NamespaceName   string `json:"namespaceName" yaml:"namespaceName"`
+	ApolloAddr      string `json:"apolloAddr" yaml:"apolloAddr"`
+	BackupDir       string `json:"backupDir" yaml:"backupDir"`
+	BackupSuffix    string `json:"backupSuffix" yaml:"backupSuffix"`
+	ConfigCacheSize int    `json:"configCacheSize" yaml:"configCacheSize"`
+	AccessKeySecret string `json:"accessKeySecret" yaml:"accessKeySecret"`
+
+	confFile string
+	// set by WithConfFile and WithEnv, options are loaded from them at Init
+	loadFile bool
+	loadEnv  bool
+
 	refreshInterval  time.Duration
 	longPollInterval time.Duration
 
-	defaultVals map[string]defaultVal
+	defaultVals map[string]map[string]defaultVal
 
 	clientIp string
 
@@ -61,6 +63,26 @@ type option struct {
 	quickInitWithBK bool
 
 	ignoreNameSpace bool
+
+	backupCrypto *backupCrypto
+	backupStore  BackupStore
+
+	backupMaxAge    time.Duration
+	backupAgePolicy BackupAgePolicy
+	schemas         map[string]*Schema
+	guards          map[string]*Guard
+	interpolation   bool
+	decryptor       Decryptor
+	unmaskedChanges bool
+	layers          []layer
+	accessTracking  bool
+	accessDumpPath  string
+	accessDumpEvery time.Duration
+
+	embeddedFallback fs.FS
+
+	localDir          string
+	localPollInterval time.Duration
 }
 
 func newDefaultOption() *option {
@@ -80,6 +102,11 @@ func newDefaultOption() *option {
 		notifyTimeout:  DEFAULT_NOTIFYTIMEOUT,
 		connectTimeout: DEFAULT_CONNECTTIMEOUT,
 		retryInterval:  DEFAULT_RETRYINTERVAL,
+
+		layers: []layer{
+			{src: gEmergency.src, priority: PRIORITY_EMERGENCY},
+			{src: remoteSource{}, priority: PRIORITY_REMOTE},
+		},
 	}
 }
 
@@ -88,25 +115,22 @@ type Option interface {
 	apply(*option)
 }
 
-// set key's default value
+// set key's default value, can be called many times for the same or different namespaces
 // for example:
 //    WithDefaultVals(map[string]interface{}{
 //		"key1": "11",
+//		"key2": 5 * time.Second,
+//		"key3": []string{"a", "b"},
 //	  }, "application")
-//    when call GetStringValue("key1"), if config key1 not found, return 11
-//   NOTE: default value is bound to type, if call GetIntValue("key1") will return 0
-//  NOTE: default value's type is in int/string/bool/float64, will panic when use other types
+//    when call GetStringValue("key1") or GetIntValue("key1"), if config key1 not found, return "11" or 11
+//  NOTE: default value can be of any type, it is converted to the type of getter on demand,
+//        zero value is returned if it can not be converted
 func WithDefaultVals(val map[string]interface{}, namespaceName string) Option {
 	return newFuncOption(func(o *option) {
-		var err error
-		o.defaultVals = make(map[string]defaultVal)
-		for k, v := range val {
-			ck := getCacheKey(namespaceName, k)
-			o.defaultVals[ck], err = newDefaultVal(v)
-			if err != nil {
-				panic(errors.WithMessage(err, "default value for key "+k))
-			}
+		if o.defaultVals == nil {
+			o.defaultVals = make(map[string]map[string]defaultVal)
 		}
+		addDefaultVals(o.defaultVals, val, namespaceName)
 	})
 }
 
@@ -166,14 +190,39 @@ func WithBackupSuffix(s string) Option {
 	})
 }
 
-// set apollo config file
+// set backup store, BackupDir and BackupSuffix are ignored when it is set
+//    WithBackupStore(NewArchiveBackupStore("/data/apollo-backup.tar.gz"))
+func WithBackupStore(store BackupStore) Option {
+	return newFuncOption(func(o *option) {
+		o.backupStore = store
+	})
+}
+
+// set apollo config file, options in file are loaded in json, yaml, or app.properties of apollo java client.
+// Init applies options in the precedence of apollo java client whatever order they are passed in,
+// file first, then environment variables of WithEnv, then the other options in code.
+//    Init(WithCluster("SG"), WithConfFile("app.yaml"), WithEnv())
 func WithConfFile(s string) Option {
 	return newFuncOption(func(o *option) {
 		o.confFile = s
-		err := loadJsonConfig(gOption, gOption.confFile)
-		if err != nil {
-			panic(errors.WithMessage(err, "loadJsonConfig"))
-		}
+		o.loadFile = true
+	})
+}
+
+// load options from environment variables named the same way as apollo java client,
+// APOLLO_APP_ID or APP_ID, APOLLO_CLUSTER, APOLLO_CONFIG_SERVICE or APOLLO_META, APOLLO_NAMESPACES,
+// APOLLO_ACCESS_KEY_SECRET and APOLLO_CACHE_DIR, variables not set or empty are ignored.
+// they win over file of WithConfFile and lose to the other options.
+func WithEnv() Option {
+	return newFuncOption(func(o *option) {
+		o.loadEnv = true
+	})
+}
+
+// set access key secret of app, requests to apollo are signed with it
+func WithAccessKeySecret(s string) Option {
+	return newFuncOption(func(o *option) {
+		o.AccessKeySecret = s
 	})
 }
 
@@ -219,6 +268,140 @@ func WithQuickInitWithBK() Option {
 	})
 }
 
+// encrypt backup files with AES-GCM, the key is got from current,
+// previous keys are only used to read backups encrypted before key rotation, these backups are re-encrypted with current key.
+//    WithBackupEncryption(NewEnvKeyProvider("APOLLO_BACKUP_KEY"))
+func WithBackupEncryption(current KeyProvider, previous ...KeyProvider) Option {
+	return newFuncOption(func(o *option) {
+		o.backupCrypto = newBackupCrypto(current, previous...)
+	})
+}
+
+// set max age of backup loaded in quick init mode or when init from apollo failed,
+// policy decides whether an older backup is used with a warning, refused, or used with client marked degraded.
+// backup written by older version has no backup time and is treated as too old.
+//    WithBackupMaxAge(7*24*time.Hour, BACKUP_AGE_DEGRADE)
+func WithBackupMaxAge(maxAge time.Duration, policy BackupAgePolicy) Option {
+	return newFuncOption(func(o *option) {
+		o.backupMaxAge = maxAge
+		o.backupAgePolicy = policy
+	})
+}
+
+// validate releases of namespace by schema, a release fails validation is rejected
+// and reported to handler registered by RegErrorEventHandler, the last good config is kept.
+//    WithSchema("application", &Schema{Keys: map[string]KeySchema{
+//        "timeout": {Type: SCHEMA_DURATION, Required: true, Min: "100ms", Max: "1m"},
+//    }})
+func WithSchema(namespaceName string, schema *Schema) Option {
+	return newFuncOption(func(o *option) {
+		if o.schemas == nil {
+			o.schemas = make(map[string]*Schema)
+		}
+		o.schemas[namespaceName] = schema
+	})
+}
+
+// protect namespace from releases deleting too many keys or being empty,
+// a release trips the guard is refused or held until ConfirmRelease, and reported to handler registered by RegErrorEventHandler.
+//    WithGuard("application", &Guard{MaxDeletePercent: 50, RefuseEmpty: true, Action: GUARD_HOLD})
+func WithGuard(namespaceName string, guard *Guard) Option {
+	return newFuncOption(func(o *option) {
+		if o.guards == nil {
+			o.guards = make(map[string]*Guard)
+		}
+		o.guards[namespaceName] = guard
+	})
+}
+
+// resolve placeholders in values, ${key} is a key of the same namespace, ${ns.key} is a key of another namespace,
+// ${VAR} is an environment variable, and ${name:default} falls back to default if name is not found.
+// key depending on a changed key is re-resolved and reported in ChangeEvent of its namespace.
+//    WithInterpolation()
+//    url = jdbc:mysql://${db.host}:${db.port:3306}/app
+func WithInterpolation() Option {
+	return newFuncOption(func(o *option) {
+		o.interpolation = true
+	})
+}
+
+// decrypt ENC(...) in values read by ConfigReader, values are kept encrypted in cache and backup,
+// and masked in ChangeEvent passed to handler registered by RegChangeEventHandler.
+//    WithDecryptor(NewAESDecryptor(NewEnvKeyProvider("APOLLO_VALUE_KEY")))
+func WithDecryptor(d Decryptor) Option {
+	return newFuncOption(func(o *option) {
+		o.decryptor = d
+	})
+}
+
+// pass values containing ENC(...) to handler registered by RegChangeEventHandler as they are, instead of masked.
+// they are still encrypted.
+func WithUnmaskedChangeValues() Option {
+	return newFuncOption(func(o *option) {
+		o.unmaskedChanges = true
+	})
+}
+
+// add a layer of config with priority, ConfigReader resolves a key through layers from the highest priority,
+// the remote layer has PRIORITY_REMOTE, a layer replaces the one with the same name.
+// changes of NotifyingSource are reported as ChangeEvent of effective values.
+//    overrides := NewOverrideSource()
+//    WithSource(NewEnvSource("APP_"), PRIORITY_ENV)
+//    WithSource(overrides, PRIORITY_OVERRIDE)
+func WithSource(src Source, priority int) Option {
+	return newFuncOption(func(o *option) {
+		o.layers = addLayer(o.layers, src, priority)
+	})
+}
+
+// WithAccessTracking counts reads of keys by ConfigReader, see GetAccessStats
+func WithAccessTracking() Option {
+	return newFuncOption(func(o *option) {
+		o.accessTracking = true
+	})
+}
+
+// WithAccessDump tracks reads of keys like WithAccessTracking, and dumps them to path every interval after Start,
+// used to find keys never read or read but missing
+//    WithAccessDump("/tmp/apollo-access.json", time.Minute)
+func WithAccessDump(path string, interval time.Duration) Option {
+	return newFuncOption(func(o *option) {
+		o.accessTracking = true
+		o.accessDumpPath = path
+		o.accessDumpEvery = interval
+	})
+}
+
+// WithEmbeddedFallback loads config from fsys when neither apollo nor backup works at Init,
+// fsys has files in the same layout as backup files, like application.apollo.json with default BackupSuffix.
+// it is not used when backup is refused by WithBackupMaxAge, whose policy is applied to files in fsys too.
+//    //go:embed fallback
+//    var fallback embed.FS
+//    sub, _ := fs.Sub(fallback, "fallback")
+//    WithEmbeddedFallback(sub)
+func WithEmbeddedFallback(fsys fs.FS) Option {
+	return newFuncOption(func(o *option) {
+		o.embeddedFallback = fsys
+	})
+}
+
+// WithLocalDir reads namespaces from files in dir instead of apollo, like a mounted ConfigMap,
+// files are polled every interval after Start and changes are pushed the same way as apollo.
+// namespace with format suffix like db.yaml is read from the file of the same name,
+// the others are read from java properties file like application.properties.
+// Init fails if dir does not exist, and logs an error for missing files, a file removed after Init is an empty namespace.
+// interval not positive is DEFAULT_LONGPOLLINTERVAL.
+//    WithLocalDir("/etc/config", time.Second)
+func WithLocalDir(dir string, interval time.Duration) Option {
+	return newFuncOption(func(o *option) {
+		if interval <= 0 {
+			interval = DEFAULT_LONGPOLLINTERVAL
+		}
+		o.localDir = dir
+		o.localPollInterval = interval
+	})
+}
+
 func WithLogFunc(logDebug, logInfo, logError logger.LogFunc) Option {
 	return newFuncOption(func(o *option) {
 		logger.LogDebug = logDebug
@@ -227,6 +410,9 @@ func WithLogFunc(logDebug, logInfo, logError logger.LogFunc) Option {
 	})
 }
 
+// IgnoreNameSpace merges namespaces into one view, keys are read without namespace from any ConfigReader.
+// when namespaces have the same key, the one listed first in NamespaceName wins, the other values are kept
+// and the key falls back to the next namespace when it is removed from the winning one.
 func IgnoreNameSpace() Option {
 	return newFuncOption(func(o *option) {
 		o.ignoreNameSpace = true
@@ -244,35 +430,3 @@ func (fo *funcOption) apply(o *option) {
 func newFuncOption(f func(*option)) *funcOption {
 	return &funcOption{f: f}
 }
-
-func loadJsonConfig(opt *option, fileName string) error {
-	fs, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		return errors.WithMessage(err, "ReadFile")
-	}
-
-	err = json.Unmarshal(fs, opt)
-	if err != nil {
-		return errors.WithMessage(err, "json.Unmarshal")
-	}
-
-	return nil
-}
-
-func newDefaultVal(i interface{}) (defaultVal, error) {
-	ret := defaultVal{}
-	switch i.(type) {
-	case int:
-		ret.i = i.(int)
-	case float64:
-		ret.f = i.(float64)
-	case bool:
-		ret.b = i.(bool)
-	case string:
-		ret.s = i.(string)
-	default:
-		msg := fmt.Sprintf("val %v is not int/float64/bool/string", i)
-		return ret, errors.New(msg)
-	}
-	return ret, nil
-}
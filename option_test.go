@@ -1,7 +1,13 @@
 package agollo
 
 import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -58,3 +64,89 @@ func Test_WithCluster_ClusterSGCoverDefault_ReturnSG(t *testing.T) {
 	}
 	recoverGlobals()
 }
+
+func Test_WithConfFile_LoadIntoBuiltOption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"apollo.json":       `{"appId": "app", "namespaceName": "application,db.yaml"}`,
+		"apollo.yaml":       "appId: app\nnamespaceName: application,db.yaml\n",
+		"app.properties":    "app.id=app\napollo.bootstrap.namespaces = application, db.yaml\n",
+		"legacy.properties": `{"appId": "app", "namespaceName": "application,db.yaml"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+		o, err := buildOption([]Option{WithCluster("SG"), WithConfFile(path)})
+		assert.Nil(t, err, name)
+		assert.Equal(t, "app", o.AppId, name)
+		assert.Equal(t, "application,db.yaml", o.NamespaceName, name)
+		// options not in file are kept
+		assert.Equal(t, "SG", o.Cluster, name)
+	}
+
+	_, err = buildOption([]Option{WithConfFile(filepath.Join(dir, "missing.json"))})
+	assert.NotNil(t, err)
+}
+
+func Test_WithEnv_Precedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.properties")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("app.id=file-app\napollo.meta=http://file-meta\napollo.cluster=file\n"), 0644))
+
+	for k, v := range map[string]string{
+		"APP_ID":                   "java-app",
+		"APOLLO_APP_ID":            "env-app",
+		"APOLLO_META":              "http://env-meta",
+		"APOLLO_CLUSTER":           "env",
+		"APOLLO_ACCESS_KEY_SECRET": "secret",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	// code wins over environment variables over file, whatever order they are passed in
+	o, err := buildOption([]Option{WithCluster("SG"), WithEnv(), WithConfFile(path)})
+	assert.Nil(t, err)
+	assert.Equal(t, "env-app", o.AppId)
+	assert.Equal(t, "http://env-meta", o.ApolloAddr)
+	assert.Equal(t, "SG", o.Cluster)
+	assert.Equal(t, "secret", o.AccessKeySecret)
+	assert.Equal(t, DEFAULT_NAMESPACENAME, o.NamespaceName)
+}
+
+func Test_AccessKeySignature_KnownAnswer(t *testing.T) {
+	// test vector of apollo java client
+	assert.Equal(t, "EoKyziXvKqzHgwx+ijDJwgVTDgE=", apollo.Signature("1576478257344",
+		"/configs/100004458/default/application?ip=10.0.0.1", "df23df3f59884980844ff3dada30fa97"))
+}
+
+func Test_WithAccessKeySecret_SignRequest(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamp := r.Header.Get(apollo.TimestampHeader)
+		expected := "Apollo app:" + apollo.Signature(timestamp, r.URL.RequestURI(), "secret")
+		authorization = r.Header.Get(apollo.AuthorizationHeader)
+		if authorization != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"appId":"app","cluster":"default","namespaceName":"application","releaseKey":"r1","configurations":{"a":"1"}}`))
+	}))
+	defer srv.Close()
+
+	cc := &apollo.ConfigCenter{
+		Host:            apollo.NewSingleHostResolver(srv.URL),
+		AppId:           "app",
+		Cluster:         "default",
+		AccessKeySecret: "secret",
+	}
+	cfg, err := cc.SyncConfig("application", "", DEFAULT_NOFICATION_ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", cfg.Configurations["a"])
+	assert.Contains(t, authorization, "Apollo app:")
+}
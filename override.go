@@ -0,0 +1,223 @@
+package agollo
+
+import (
+	"encoding/json"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// priority of overrides set by SetOverride, higher than all built-in layers
+	PRIORITY_EMERGENCY = 600
+
+	// name of the layer of overrides set by SetOverride
+	emergencySourceName = "emergency"
+	// name of overrides in backup store, next to backups of namespaces
+	overridesBackupName = "agollo-overrides"
+)
+
+type (
+	// Override is a value set by SetOverride
+	Override struct {
+		Namespace string    `json:"namespace"`
+		Key       string    `json:"key"`
+		Value     string    `json:"value"`
+		ExpireAt  time.Time `json:"expireAt"`
+	}
+
+	// emergencyOverrides adds expire time and persistence to values in an OverrideSource,
+	// which is the layer with PRIORITY_EMERGENCY. overrides are persisted to backup store on every change,
+	// the ones set before Init are saved at Init.
+	emergencyOverrides struct {
+		mu      sync.Mutex
+		src     *OverrideSource
+		entries map[string]map[string]*overrideEntry
+		// overrides are changed before backup store is set
+		pending bool
+	}
+
+	overrideEntry struct {
+		Override
+		timer *time.Timer
+	}
+
+	overridesFile struct {
+		Overrides []Override `json:"overrides"`
+	}
+)
+
+var gEmergency = newEmergencyOverrides()
+
+func newEmergencyOverrides() *emergencyOverrides {
+	return &emergencyOverrides{
+		src:     &OverrideSource{name: emergencySourceName, values: make(map[string]map[string]string)},
+		entries: make(map[string]map[string]*overrideEntry),
+	}
+}
+
+// SetOverride forces value of key in namespace on this instance for ttl, it wins over all layers.
+// overrides are kept next to backups and loaded again at Init until they expire.
+func SetOverride(namespaceName, key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl of override must be positive")
+	}
+	return gEmergency.set(Override{
+		Namespace: namespaceName,
+		Key:       key,
+		Value:     value,
+		ExpireAt:  time.Now().Add(ttl),
+	})
+}
+
+// ClearOverride removes override of key in namespace set by SetOverride
+func ClearOverride(namespaceName, key string) error {
+	return gEmergency.remove(namespaceName, key, nil)
+}
+
+// GetOverrides returns overrides not expired yet
+func GetOverrides() []Override {
+	return gEmergency.list()
+}
+
+func (s *emergencyOverrides) set(o Override) error {
+	s.mu.Lock()
+	s.put(o)
+	fire := s.src.set(o.Namespace, o.Key, o.Value)
+	err := s.save()
+	s.mu.Unlock()
+
+	logger.LogInfo("override %s %s until %v", o.Namespace, o.Key, o.ExpireAt)
+	fire()
+	return err
+}
+
+// put adds override removed by itself when it expires, s.mu must be held
+func (s *emergencyOverrides) put(o Override) {
+	kv, ok := s.entries[o.Namespace]
+	if !ok {
+		kv = make(map[string]*overrideEntry)
+		s.entries[o.Namespace] = kv
+	}
+	if old, ok := kv[o.Key]; ok {
+		old.timer.Stop()
+	}
+	e := &overrideEntry{Override: o}
+	e.timer = time.AfterFunc(time.Until(o.ExpireAt), func() {
+		if err := s.remove(o.Namespace, o.Key, e); err != nil {
+			logger.LogError("expire override of %s %s fail: %v", o.Namespace, o.Key, err)
+		}
+	})
+	kv[o.Key] = e
+}
+
+// remove deletes override of key, only if it is still entry when entry is not nil
+func (s *emergencyOverrides) remove(namespaceName, key string, entry *overrideEntry) error {
+	s.mu.Lock()
+	e, ok := s.entries[namespaceName][key]
+	if !ok || (entry != nil && e != entry) {
+		s.mu.Unlock()
+		return nil
+	}
+	e.timer.Stop()
+	delete(s.entries[namespaceName], key)
+	fire := s.src.delete(namespaceName, key)
+	err := s.save()
+	s.mu.Unlock()
+
+	logger.LogInfo("override %s %s is removed", namespaceName, key)
+	fire()
+	return err
+}
+
+func (s *emergencyOverrides) list() []Override {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overrides()
+}
+
+// overrides returns overrides not expired sorted by namespace and key, s.mu must be held
+func (s *emergencyOverrides) overrides() []Override {
+	now := time.Now()
+	ret := make([]Override, 0)
+	for _, kv := range s.entries {
+		for _, e := range kv {
+			if now.Before(e.ExpireAt) {
+				ret = append(ret, e.Override)
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// save writes overrides to backup store, encrypted the same way as backups, s.mu must be held.
+// overrides changed before Init are saved by load at Init.
+func (s *emergencyOverrides) save() error {
+	if gOption == nil {
+		s.pending = true
+		return nil
+	}
+	s.pending = false
+	b, err := json.MarshalIndent(overridesFile{Overrides: s.overrides()}, "", "\t")
+	if err != nil {
+		return errors.WithMessage(err, "json.MarshalIndent")
+	}
+	if b, err = wrapBackup(append(b, '\n')); err != nil {
+		return errors.WithMessage(err, "wrapBackup")
+	}
+	store := getBackupStore()
+	unlock, err := lockBackup(store, overridesBackupName, true)
+	if err != nil {
+		return errors.WithMessage(err, "lockBackup")
+	}
+	defer unlock()
+	return errors.WithMessage(store.Save(overridesBackupName, b), "save overrides")
+}
+
+// load merges overrides saved in backup store into the ones in memory, expired ones are dropped, no event is fired.
+// an override set before Init is newer than the saved one of the same key, it is kept and saved.
+func (s *emergencyOverrides) load() error {
+	store := getBackupStore()
+	unlock, err := lockBackup(store, overridesBackupName, false)
+	if err != nil {
+		return errors.WithMessage(err, "lockBackup")
+	}
+	b, err := store.Load(overridesBackupName)
+	unlock()
+	of := overridesFile{}
+	if err != nil && errors.Cause(err) != ErrBackupNotFound {
+		return errors.WithMessage(err, "load overrides")
+	}
+	if err == nil {
+		if b, _, err = unwrapBackup(b); err != nil {
+			return errors.WithMessage(err, "unwrapBackup")
+		}
+		if err = json.Unmarshal(b, &of); err != nil {
+			return errors.WithMessage(err, "json.Unmarshal")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, o := range of.Overrides {
+		if _, ok := s.entries[o.Namespace][o.Key]; ok || !now.Before(o.ExpireAt) {
+			continue
+		}
+		s.put(o)
+		s.src.set(o.Namespace, o.Key, o.Value)
+		logger.LogInfo("override %s %s is loaded, until %v", o.Namespace, o.Key, o.ExpireAt)
+	}
+	if !s.pending {
+		return nil
+	}
+	return s.save()
+}
@@ -0,0 +1,117 @@
+package agollo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOverride(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	defer resetEmergency()
+	gEmergency.src.SetNotify(func(event *ChangeEvent) {
+		onSourceChange(gEmergency.src, event)
+	})
+	setTestConfig("application", map[string]string{"db.host": "remote-host"})
+
+	// expired override is removed in timer goroutine
+	var mu sync.Mutex
+	var events []*ChangeEvent
+	RegChangeEventHandler(func(event *ChangeEvent) error {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+		return nil
+	})
+	defer RegChangeEventHandler(nil)
+
+	cr := GetConfigReader("application")
+	assert.NotNil(t, SetOverride("application", "db.host", "x", 0))
+	assert.Nil(t, SetOverride("application", "db.host", "override-host", time.Hour))
+	host, _ := cr.GetStringValue("db.host")
+	assert.Equal(t, "override-host", host)
+	assert.Nil(t, SetOverride("application", "db.port", "3307", 50*time.Millisecond))
+	assert.Len(t, GetOverrides(), 2)
+
+	// overrides are loaded from backup store, expired ones are dropped
+	resetEmergency()
+	assert.Nil(t, gEmergency.load())
+	assert.Equal(t, []string{"db.host", "db.port"}, overrideKeys())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"db.host"}, overrideKeys())
+	resetEmergency()
+	assert.Nil(t, gEmergency.load())
+	assert.Equal(t, []string{"db.host"}, overrideKeys())
+	assert.True(t, GetOverrides()[0].ExpireAt.After(time.Now().Add(time.Minute)))
+
+	assert.Nil(t, ClearOverride("application", "db.host"))
+	assert.Nil(t, ClearOverride("application", "db.host"))
+	host, _ = cr.GetStringValue("db.host")
+	assert.Equal(t, "remote-host", host)
+	assert.Empty(t, GetOverrides())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []*ChangeEvent{
+		{Namespace: "application", Changes: []*ConfigChange{newModifyConfigChange("db.host", "remote-host", "override-host")}},
+		{Namespace: "application", Changes: []*ConfigChange{newAddConfigChange("db.port", "3307")}},
+		{Namespace: "application", Changes: []*ConfigChange{newDeletedConfigChange("db.port", "3307")}},
+		{Namespace: "application", Changes: []*ConfigChange{newModifyConfigChange("db.host", "override-host", "remote-host")}},
+	}, events)
+}
+
+func TestOverride_SetBeforeInit(t *testing.T) {
+	defer resetEmergency()
+	bkOpt := gOption
+	defer func() { gOption = bkOpt }()
+	gOption = nil
+	assert.Nil(t, SetOverride("application", "db.host", "early-host", time.Hour))
+
+	// saved override of the same key is older
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	saved := &emergencyOverrides{src: NewOverrideSource(), entries: make(map[string]map[string]*overrideEntry)}
+	assert.Nil(t, saved.set(Override{Namespace: "application", Key: "db.host", Value: "saved-host", ExpireAt: time.Now().Add(time.Hour)}))
+	assert.Nil(t, saved.set(Override{Namespace: "application", Key: "db.port", Value: "3307", ExpireAt: time.Now().Add(time.Hour)}))
+	saved.mu.Lock()
+	for _, kv := range saved.entries {
+		for _, e := range kv {
+			e.timer.Stop()
+		}
+	}
+	saved.mu.Unlock()
+
+	assert.Nil(t, gEmergency.load())
+	assert.Equal(t, []string{"db.host", "db.port"}, overrideKeys())
+	host, _ := gEmergency.src.Get("application", "db.host")
+	assert.Equal(t, "early-host", host)
+
+	// override set before Init is saved at Init
+	resetEmergency()
+	assert.Nil(t, gEmergency.load())
+	host, _ = gEmergency.src.Get("application", "db.host")
+	assert.Equal(t, "early-host", host)
+}
+
+func resetEmergency() {
+	gEmergency.mu.Lock()
+	for _, kv := range gEmergency.entries {
+		for _, e := range kv {
+			e.timer.Stop()
+		}
+	}
+	gEmergency.entries = make(map[string]map[string]*overrideEntry)
+	gEmergency.src.values = make(map[string]map[string]string)
+	gEmergency.pending = false
+	gEmergency.mu.Unlock()
+}
+
+func overrideKeys() []string {
+	keys := make([]string, 0)
+	for _, o := range GetOverrides() {
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
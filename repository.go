@@ -23,6 +23,11 @@ var (
 	gConfigCache     *cache
 	cacheMutex       sync.Mutex
 	gIgnoreNameSpace bool
+
+	// listeners are called after cache is updated, including the update when Init
+	gListeners      = make(map[int64]func(event *ChangeEvent))
+	gListenerId     int64
+	gListenersMutex sync.RWMutex
 )
 
 func initCache(sz int, ignore bool) *cache {
@@ -30,6 +35,8 @@ func initCache(sz int, ignore bool) *cache {
 		fc: freecache.NewCache(sz),
 	}
 	gIgnoreNameSpace = ignore
+	resetMerged()
+	resetReleases()
 	return gConfigCache
 }
 
@@ -60,25 +67,55 @@ func Cleanup() {
 	cacheMutex.Lock()
 	gConfigCache.Clear()
 	cacheMutex.Unlock()
+	resetMerged()
+	resetReleases()
 }
 
-func updateCache(ac *apollo.Config, ns *namespace, event *ChangeEvent) {
+// updateCache updates cache and writes backup, changes of effective values are returned,
+// including other namespaces whose placeholders depend on the namespace
+func updateCache(ac *apollo.Config, ns *namespace, event *ChangeEvent) []*ChangeEvent {
 	if ac == nil || ns == nil {
 		// nothing changed
-		return
+		return nil
 	}
 
-	ns.releaseKey = ac.ReleaseKey
-	doUpdateCache(event)
+	effective := updateMemoryCache(ac, ns, event)
 
 	// write config file async
-	path := getConfigPath(ac.NamespaceName)
-	_ = writeConfigFile(ac, path)
+	_ = writeConfigFile(ac, ns.NotificationId, ns.fetchTime)
+	return effective
+}
+
+// updateMemoryCache updates cache without writing backup, used when config is loaded from backup
+func updateMemoryCache(ac *apollo.Config, ns *namespace, event *ChangeEvent) []*ChangeEvent {
+	if ac == nil || ns == nil {
+		return nil
+	}
+	ns.releaseKey = ac.ReleaseKey
+	recordUpdated(ac.NamespaceName, ac.ReleaseKey, ns.fetchTime)
+	keepRelease(ac, ns)
+	effective := []*ChangeEvent{updateRemote(event)}
+	return append(effective, setRaw(ac)...)
+}
+
+// updateRemote updates cache by event of remote config, listeners get changes of effective values, which are returned
+func updateRemote(event *ChangeEvent) *ChangeEvent {
+	if gIgnoreNameSpace {
+		event = updateMergedCache(event)
+	} else {
+		doUpdateCache(event)
+	}
+	effective := layeredChangeEvent(remoteSource{}, event)
+	notifyChangeListeners(effective)
+	return effective
 }
 
 func pushChange(ns *namespace, event *ChangeEvent) {
 	if len(event.Changes) > 0 {
 		if gCallback != nil {
+			if gOption == nil || !gOption.unmaskedChanges {
+				event = maskChangeEvent(event)
+			}
 			err := gCallback(event)
 			if err != nil {
 				logger.LogError("Callback config change handler fail: %v", err)
@@ -87,6 +124,39 @@ func pushChange(ns *namespace, event *ChangeEvent) {
 		}
 	}
 }
+
+func pushError(event *ErrorEvent) {
+	logger.LogError("release %s of %s is rejected: %v", event.ReleaseKey, event.Namespace, event.Err)
+	if gErrorCallback != nil {
+		gErrorCallback(event)
+	}
+}
+
+func addChangeListener(l func(event *ChangeEvent)) int64 {
+	gListenersMutex.Lock()
+	defer gListenersMutex.Unlock()
+	gListenerId++
+	gListeners[gListenerId] = l
+	return gListenerId
+}
+
+func removeChangeListener(id int64) {
+	gListenersMutex.Lock()
+	delete(gListeners, id)
+	gListenersMutex.Unlock()
+}
+
+func notifyChangeListeners(event *ChangeEvent) {
+	if len(event.Changes) == 0 {
+		return
+	}
+	gListenersMutex.RLock()
+	defer gListenersMutex.RUnlock()
+	for _, l := range gListeners {
+		l(event)
+	}
+}
+
 func doUpdateCache(event *ChangeEvent) error {
 	ns := event.Namespace
 	var ck string
@@ -123,7 +193,10 @@ func getConfigChangeEvent(namespaceName string, configurations map[string]string
 	for en := it.Next(); en != nil; en = it.Next() {
 		ck := string(en.Key)
 		if strings.HasPrefix(ck, nnd) {
-			mp[ck] = gConfigCache.Unmarshal(en.Value)
+			// namespace may contain SEP, like app.yaml and app.yaml.bak
+			if e := gConfigCache.Unmarshal(en.Value); e.NameSpace == namespaceName {
+				mp[ck] = e
+			}
 		}
 	}
 
@@ -146,56 +219,13 @@ func getConfigChangeEvent(namespaceName string, configurations map[string]string
 
 	// remove del keys
 	for ck, v := range mp {
-		k := ck[strings.Index(ck, SEP)+1:]
+		k := strings.TrimPrefix(ck, nnd)
 		changes = append(changes, newDeletedConfigChange(k, v.Val))
 	}
 
 	return changes
 }
 
-func getChangeEventWithIgnore(namespaceName string, configurations map[string]string) []*ConfigChange {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-	if (configurations == nil || len(configurations) == 0) && gConfigCache.EntryCount() == 0 {
-		return nil
-	}
-
-	// get old keys
-	mp := make(map[string]element)
-	it := gConfigCache.NewIterator()
-	for en := it.Next(); en != nil; en = it.Next() {
-		ck := string(en.Key)
-		mp[ck] = gConfigCache.Unmarshal(en.Value)
-	}
-
-	configChanges := make([]*ConfigChange, 0)
-	if configurations != nil {
-		for k, v := range configurations {
-			ck := getCacheKey(namespaceName, k) // immutable key
-			old, ok := mp[ck]                   // all key
-			if ok {
-				if old.Val != v {
-					configChanges = append(configChanges, newModifyConfigChange(k, old.Val, v))
-				}
-				delete(mp, ck) // remain mutable
-			} else {
-				configChanges = append(configChanges, newAddConfigChange(k, v))
-			}
-		}
-	}
-
-	// remove del keys
-	for ck, v := range mp {
-		if v.NameSpace != namespaceName {
-			delete(mp, ck) // remove config not included this nameSpace, avoid match delete configuration
-			continue
-		}
-		configChanges = append(configChanges, newDeletedConfigChange(ck, v.Val))
-	}
-
-	return configChanges
-}
-
 func getCacheKey(namespaceName string, key string) string {
 	if gIgnoreNameSpace {
 		return key
@@ -204,16 +234,21 @@ func getCacheKey(namespaceName string, key string) string {
 }
 
 func getChangeEvent(ac *apollo.Config) *ChangeEvent {
+	return getConfigurationsChangeEvent(ac.NamespaceName, effectiveConfigurations(ac))
+}
+
+// getConfigurationsChangeEvent compares configurations of namespace with cache
+func getConfigurationsChangeEvent(namespaceName string, configurations map[string]string) *ChangeEvent {
 	// Currently, only one goroutine will write memory
 	var cl []*ConfigChange
 	if gIgnoreNameSpace {
-		cl = getChangeEventWithIgnore(ac.NamespaceName, ac.Configurations)
+		cl = getMergedChanges(namespaceName, configurations)
 	} else {
-		cl = getConfigChangeEvent(ac.NamespaceName, ac.Configurations)
+		cl = getConfigChangeEvent(namespaceName, configurations)
 	}
 
 	event := &ChangeEvent{
-		Namespace: ac.NamespaceName,
+		Namespace: namespaceName,
 		Changes:   cl,
 	}
 	return event
@@ -9,7 +9,7 @@ import (
 )
 
 func TestCache_getChangeEvent(t *testing.T) {
-	gOption = newDefaultOption()
+	defer useTestBackupStore(NewMemoryBackupStore())()
 	initCache(2, false)
 	nl := []*namespace{
 		{
@@ -174,7 +174,7 @@ func sortChanges(changes *ChangeEvent) *ChangeEvent {
 }
 
 func TestCache_getChangeEvent_ignore(t *testing.T) {
-	gOption = newDefaultOption()
+	defer useTestBackupStore(NewMemoryBackupStore())()
 	initCache(2, true)
 	nl := []*namespace{
 		{
@@ -0,0 +1,236 @@
+package agollo
+
+import (
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Key types of schema, value of key must be parsed as the type by ConfigReader
+const (
+	SCHEMA_STRING KeyType = iota
+	SCHEMA_INT
+	SCHEMA_FLOAT
+	SCHEMA_BOOL
+	SCHEMA_DURATION
+	SCHEMA_BYTE_SIZE
+	SCHEMA_TIME
+	SCHEMA_STRING_SLICE
+	SCHEMA_JSON_OBJECT
+	SCHEMA_JSON_ARRAY
+)
+
+// KeyType is the type of value of key declared in schema
+type KeyType int
+
+type (
+	// Schema declares keys expected in a namespace, a release fails validation is not applied
+	Schema struct {
+		Keys map[string]KeySchema
+		// JSON Schema validating content of json or yaml namespace,
+		// type, enum, properties, required, additionalProperties, items,
+		// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern,
+		// minItems and maxItems are supported
+		JSONSchema string
+
+		json *jsonSchema
+	}
+
+	// KeySchema declares a key of namespace
+	KeySchema struct {
+		Type     KeyType
+		Required bool
+		// bounds in the format of Type, like "1s" for SCHEMA_DURATION, empty is unbounded.
+		// they are bounds of length for SCHEMA_STRING, SCHEMA_STRING_SLICE and JSON types.
+		Min, Max string
+		// regexp the raw value must match
+		Pattern string
+
+		pattern  *regexp.Regexp
+		min, max *float64
+	}
+)
+
+func (s *Schema) compile() error {
+	for k, ks := range s.Keys {
+		if err := ks.compile(); err != nil {
+			return errors.WithMessage(err, "key "+k)
+		}
+		s.Keys[k] = ks
+	}
+	if s.JSONSchema != "" {
+		js, err := parseJsonSchema([]byte(s.JSONSchema))
+		if err != nil {
+			return errors.WithMessage(err, "JSONSchema")
+		}
+		s.json = js
+	}
+	return nil
+}
+
+func (ks *KeySchema) compile() error {
+	var err error
+	if ks.Pattern != "" {
+		if ks.pattern, err = regexp.Compile(ks.Pattern); err != nil {
+			return errors.WithMessage(err, "Pattern")
+		}
+	}
+	if ks.Min != "" {
+		if ks.min, err = ks.bound(ks.Min); err != nil {
+			return errors.WithMessage(err, "Min")
+		}
+	}
+	if ks.Max != "" {
+		if ks.max, err = ks.bound(ks.Max); err != nil {
+			return errors.WithMessage(err, "Max")
+		}
+	}
+	return nil
+}
+
+func (ks *KeySchema) bound(s string) (*float64, error) {
+	var f float64
+	var err error
+	switch ks.Type {
+	case SCHEMA_DURATION:
+		var d time.Duration
+		d, err = parseDuration(s)
+		f = float64(d)
+	case SCHEMA_BYTE_SIZE:
+		var bs int64
+		bs, err = parseByteSize(s)
+		f = float64(bs)
+	case SCHEMA_TIME:
+		var t time.Time
+		t, err = parseTime(s)
+		f = float64(t.UnixNano())
+	case SCHEMA_BOOL:
+		err = errors.New("bool has no bounds")
+	case SCHEMA_INT, SCHEMA_FLOAT:
+		f, err = parseFloat(s)
+	default:
+		// bounds of length
+		var i int
+		i, err = parseInt(s)
+		f = float64(i)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// validate parses value as the type and checks it is in bounds
+func (ks *KeySchema) validate(value string) error {
+	if ks.pattern != nil && !ks.pattern.MatchString(value) {
+		return errors.New(fmt.Sprintf("not match %s", ks.Pattern))
+	}
+
+	var f float64
+	var err error
+	switch ks.Type {
+	case SCHEMA_INT:
+		var i int64
+		i, err = parseInt64(value)
+		f = float64(i)
+	case SCHEMA_FLOAT:
+		f, err = parseFloat(value)
+	case SCHEMA_BOOL:
+		_, err = parseBool(value)
+	case SCHEMA_DURATION:
+		var d time.Duration
+		d, err = parseDuration(value)
+		f = float64(d)
+	case SCHEMA_BYTE_SIZE:
+		var bs int64
+		bs, err = parseByteSize(value)
+		f = float64(bs)
+	case SCHEMA_TIME:
+		var t time.Time
+		t, err = parseTime(value)
+		f = float64(t.UnixNano())
+	case SCHEMA_STRING_SLICE:
+		f = float64(len(parseStringSlice(value)))
+	case SCHEMA_JSON_OBJECT:
+		var m map[string]interface{}
+		m, err = parseMap(value)
+		f = float64(len(m))
+	case SCHEMA_JSON_ARRAY:
+		var s []interface{}
+		s, err = parseSlice(value)
+		f = float64(len(s))
+	default:
+		f = float64(utf8.RuneCountInString(value))
+	}
+	if err != nil {
+		return err
+	}
+
+	if ks.min != nil && f < *ks.min {
+		return errors.New("less than min " + ks.Min)
+	}
+	if ks.max != nil && f > *ks.max {
+		return errors.New("greater than max " + ks.Max)
+	}
+	return nil
+}
+
+// validateConfig validates a release against schema of its namespace, keys decoded from content are validated too
+func validateConfig(ac *apollo.Config) error {
+	if gOption == nil {
+		return nil
+	}
+	s, ok := gOption.schemas[ac.NamespaceName]
+	if !ok {
+		return nil
+	}
+
+	configurations := effectiveConfigurations(ac)
+	retErr := apollo.NewMutliError()
+	keys := make([]string, 0, len(s.Keys))
+	for k := range s.Keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ks := s.Keys[k]
+		value, ok := configurations[k]
+		if !ok {
+			if ks.Required {
+				retErr = multierror.Append(retErr, errors.New("required key "+k+" is missing"))
+			}
+			continue
+		}
+		display, encrypted := value, isEncrypted(value)
+		if encrypted {
+			display = maskedValue
+			var err error
+			if value, err = decryptValue(value); err != nil {
+				retErr = multierror.Append(retErr, errors.WithMessage(err, "key "+k))
+				continue
+			}
+		}
+		if err := ks.validate(value); err != nil {
+			if encrypted {
+				// error of parser may contain the value
+				err = errors.New("invalid decrypted value")
+			}
+			retErr = multierror.Append(retErr, errors.WithMessage(err, fmt.Sprintf("key %s value %q", k, display)))
+		}
+	}
+
+	if s.json != nil {
+		if err := validateContent(s.json, ac.NamespaceName, ac.Configurations[contentKey]); err != nil {
+			retErr = multierror.Append(retErr, errors.WithMessage(err, "content"))
+		}
+	}
+	if err := retErr.ErrorOrNil(); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("validate release %s of %s", ac.ReleaseKey, ac.NamespaceName))
+	}
+	return nil
+}
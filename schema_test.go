@@ -0,0 +1,99 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSchema_Keys(t *testing.T) {
+	schema := &Schema{Keys: map[string]KeySchema{
+		"timeout": {Type: SCHEMA_DURATION, Required: true, Min: "100ms", Max: "1m"},
+		"port":    {Type: SCHEMA_INT, Min: "1", Max: "65535"},
+		"name":    {Type: SCHEMA_STRING, Pattern: "^[a-z]+$", Max: "8"},
+		"hosts":   {Type: SCHEMA_STRING_SLICE, Min: "1"},
+		"debug":   {Type: SCHEMA_BOOL},
+	}}
+	assert.Nil(t, schema.compile())
+
+	for _, c := range []struct {
+		key, value string
+		valid      bool
+	}{
+		{"timeout", "5s", true},
+		{"timeout", "10ms", false},
+		{"timeout", "5", false},
+		{"port", "8080", true},
+		{"port", "70000", false},
+		{"port", "80a", false},
+		{"name", "abc", true},
+		{"name", "Abc", false},
+		{"name", "abcdefghi", false},
+		{"hosts", "a,b", true},
+		{"hosts", "", false},
+		{"debug", "yes", false},
+	} {
+		ks := schema.Keys[c.key]
+		err := ks.validate(c.value)
+		assert.Equal(t, c.valid, err == nil, "%s=%s %v", c.key, c.value, err)
+	}
+
+	assert.NotNil(t, (&Schema{Keys: map[string]KeySchema{"a": {Type: SCHEMA_BOOL, Min: "1"}}}).compile())
+	assert.NotNil(t, (&Schema{Keys: map[string]KeySchema{"a": {Pattern: "("}}}).compile())
+}
+
+func TestSchema_ValidateConfig(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	schema := &Schema{
+		Keys: map[string]KeySchema{
+			"db.port": {Type: SCHEMA_INT, Required: true},
+		},
+		JSONSchema: `{
+			"type": "object",
+			"required": ["db"],
+			"properties": {
+				"db": {
+					"type": "object",
+					"additionalProperties": false,
+					"properties": {
+						"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+						"mode": {"enum": ["rw", "ro"]},
+						"hosts": {"type": "array", "minItems": 1, "items": {"type": "string", "minLength": 1}}
+					}
+				}
+			}
+		}`,
+	}
+	assert.Nil(t, schema.compile())
+	gOption.schemas = map[string]*Schema{"app.yaml": schema, "app.json": schema}
+
+	ac := &apollo.Config{ConnConfig: apollo.ConnConfig{NamespaceName: "app.yaml", ReleaseKey: "r1"}}
+	for _, c := range []struct {
+		content string
+		valid   bool
+	}{
+		{"db:\n  port: 3306\n  mode: ro\n  hosts: [a]\n", true},
+		{"db:\n  port: 3306.5\n", false},
+		{"db:\n  port: 0\n", false},
+		{"db:\n  port: 3306\n  mode: x\n", false},
+		{"db:\n  port: 3306\n  hosts: []\n", false},
+		{"db:\n  port: 3306\n  hosts: ['']\n", false},
+		{"db:\n  port: 3306\n  user: a\n", false},
+		{"other: 1\n", false},
+		{"db: [", false},
+	} {
+		ac.Configurations = map[string]string{contentKey: c.content}
+		err := validateConfig(ac)
+		assert.Equal(t, c.valid, err == nil, "%q %v", c.content, err)
+	}
+
+	ac.NamespaceName = "app.json"
+	ac.Configurations = map[string]string{contentKey: `{"db":{"port":3306}}`}
+	assert.Nil(t, validateConfig(ac))
+	ac.Configurations = map[string]string{contentKey: `{"db":{"port":"3306"}}`}
+	assert.NotNil(t, validateConfig(ac))
+
+	// namespace without schema is not validated
+	ac.NamespaceName = "application"
+	assert.Nil(t, validateConfig(ac))
+}
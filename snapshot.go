@@ -0,0 +1,144 @@
+package agollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// version of snapshot file written by Export
+const snapshotVersion = 1
+
+type (
+	// snapshot is the client state written by Export, configurations are the releases got from apollo,
+	// before decoding and interpolation, ENC(...) is kept as it is
+	snapshot struct {
+		Version    int                 `json:"version"`
+		ExportTime time.Time           `json:"exportTime"`
+		AppId      string              `json:"appId"`
+		Cluster    string              `json:"cluster"`
+		Namespaces []snapshotNamespace `json:"namespaces"`
+	}
+
+	snapshotNamespace struct {
+		*apollo.Config
+		NotificationId int64 `json:"notificationId"`
+	}
+)
+
+var (
+	// releases in cache by namespace, kept for Export
+	gReleases      = make(map[string]snapshotNamespace)
+	gReleasesMutex sync.Mutex
+)
+
+func keepRelease(ac *apollo.Config, ns *namespace) {
+	gReleasesMutex.Lock()
+	gReleases[ac.NamespaceName] = snapshotNamespace{Config: ac, NotificationId: ns.NotificationId}
+	gReleasesMutex.Unlock()
+}
+
+func resetReleases() {
+	gReleasesMutex.Lock()
+	gReleases = make(map[string]snapshotNamespace)
+	gReleasesMutex.Unlock()
+}
+
+// Export writes releases of all namespaces in cache, with their release keys and notification ids, to a JSON file,
+// which is restored by Import without apollo. values are written as they are in apollo, secrets included.
+func Export(path string) error {
+	snap := snapshot{Version: snapshotVersion, ExportTime: time.Now()}
+	if gOption != nil {
+		snap.AppId = gOption.AppId
+		snap.Cluster = gOption.Cluster
+	}
+
+	gReleasesMutex.Lock()
+	for _, sn := range gReleases {
+		snap.Namespaces = append(snap.Namespaces, sn)
+	}
+	gReleasesMutex.Unlock()
+	sort.Slice(snap.Namespaces, func(i, j int) bool {
+		return snap.Namespaces[i].NamespaceName < snap.Namespaces[j].NamespaceName
+	})
+	if gService != nil {
+		// notification id is updated before the release is fetched
+		for i, sn := range snap.Namespaces {
+			if ns := gService.findNamespace(sn.NamespaceName); ns != nil {
+				snap.Namespaces[i].NotificationId = ns.NotificationId
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(snap, "", "\t")
+	if err != nil {
+		return errors.WithMessage(err, "json.MarshalIndent")
+	}
+	return errors.WithMessage(writeFileAtomic(path, append(b, '\n')), "writeFileAtomic")
+}
+
+// Import puts releases in file written by Export into cache, change handler and listeners get the changes.
+// it is called instead of Init to reproduce config locally, or after Init and before Start,
+// AppId, Cluster and NamespaceName are taken from file if Init is not called.
+func Import(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.WithMessage(err, "ReadFile")
+	}
+	snap := snapshot{}
+	if err = json.Unmarshal(b, &snap); err != nil {
+		return errors.WithMessage(err, "json.Unmarshal")
+	}
+	if snap.Version != snapshotVersion {
+		return errors.New(fmt.Sprintf("unsupported snapshot version %d", snap.Version))
+	}
+	for _, sn := range snap.Namespaces {
+		if sn.Config == nil || sn.NamespaceName == "" {
+			return errors.New("snapshot has namespace without release")
+		}
+	}
+
+	if gOption == nil {
+		gOption = newDefaultOption()
+		gOption.AppId = snap.AppId
+		gOption.Cluster = snap.Cluster
+		names := make([]string, len(snap.Namespaces))
+		for i, sn := range snap.Namespaces {
+			names[i] = sn.NamespaceName
+		}
+		gOption.NamespaceName = strings.Join(names, ",")
+	}
+	if gConfigCache == nil {
+		initCache(gOption.ConfigCacheSize, gOption.ignoreNameSpace)
+	}
+
+	for _, sn := range snap.Namespaces {
+		var ns *namespace
+		if gService != nil {
+			ns = gService.findNamespace(sn.NamespaceName)
+		}
+		if ns == nil {
+			ns = &namespace{NamespaceName: sn.NamespaceName}
+		}
+		ns.NotificationId = sn.NotificationId
+		for _, e := range updateMemoryCache(sn.Config, ns, getChangeEvent(sn.Config)) {
+			pushChange(ns, e)
+		}
+	}
+	return nil
+}
+
+func (s *service) findNamespace(namespaceName string) *namespace {
+	for _, v := range s.namespaceList {
+		if v.NamespaceName == namespaceName {
+			return v
+		}
+	}
+	return nil
+}
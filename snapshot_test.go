@@ -0,0 +1,57 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot_ExportImport(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	gOption.AppId = "app"
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	for i, ns := range []string{"application", "db.yaml"} {
+		cfg := &apollo.Config{
+			ConnConfig:     apollo.ConnConfig{NamespaceName: ns, ReleaseKey: "release-" + ns},
+			Configurations: map[string]string{"key": ns},
+		}
+		if ns == "db.yaml" {
+			cfg.Configurations = map[string]string{contentKey: "db:\n  host: localhost\n"}
+		}
+		updateMemoryCache(cfg, &namespace{NamespaceName: ns, NotificationId: int64(i + 10)}, getChangeEvent(cfg))
+	}
+
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	assert.Nil(t, Export(path))
+
+	// restored into a client without Init
+	gOption = nil
+	gConfigCache = nil
+	var events []*ChangeEvent
+	RegChangeEventHandler(func(event *ChangeEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	defer RegChangeEventHandler(nil)
+	assert.Nil(t, Import(path))
+	assert.Equal(t, "app", gOption.AppId)
+	assert.Equal(t, "application,db.yaml", gOption.NamespaceName)
+	assert.Len(t, events, 2)
+
+	v, _ := GetConfigReader("application").GetStringValue("key")
+	assert.Equal(t, "application", v)
+	v, _ = GetConfigReader("db.yaml").GetStringValue("db.host")
+	assert.Equal(t, "localhost", v)
+	assert.Equal(t, "release-db.yaml", GetConfigReader("db.yaml").GetReleaseKey())
+	assert.Equal(t, int64(11), gReleases["db.yaml"].NotificationId)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"version":2}`), 0644))
+	assert.NotNil(t, Import(path))
+	assert.NotNil(t, Import(filepath.Join(dir, "missing.json")))
+}
@@ -0,0 +1,379 @@
+package agollo
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Priorities of layers, a layer with higher priority shadows the lower ones,
+// default values set by WithDefaultVals are used when no layer has the key
+const (
+	PRIORITY_EMBEDDED = 100
+	PRIORITY_REMOTE   = 200
+	PRIORITY_FILE     = 300
+	PRIORITY_ENV      = 400
+	PRIORITY_OVERRIDE = 500
+)
+
+// name of the layer of config got from apollo
+const remoteSourceName = "remote"
+
+type (
+	// Source is a layer of config, ConfigReader resolves a key through layers by priority
+	Source interface {
+		// Name identifies the layer, a layer replaces the one with the same name
+		Name() string
+		Get(namespaceName, key string) (string, bool)
+	}
+
+	// NotifyingSource is a Source whose values change at runtime,
+	// the client sets notify at Init and the source calls it with changes of its own values.
+	NotifyingSource interface {
+		Source
+		SetNotify(notify func(event *ChangeEvent))
+	}
+
+	// ListingSource is a Source able to list its keys, only keys of ListingSource are returned by Keys of ConfigReader
+	ListingSource interface {
+		Source
+		Keys(namespaceName string) []string
+	}
+
+	layer struct {
+		src      Source
+		priority int
+	}
+
+	remoteSource struct{}
+
+	mapSource struct {
+		name    string
+		configs map[string]map[string]string
+	}
+
+	envSource struct {
+		prefix string
+	}
+
+	// OverrideSource holds values set by program, it is a NotifyingSource
+	OverrideSource struct {
+		mu sync.RWMutex
+		// name of the layer, "override" if empty
+		name   string
+		values map[string]map[string]string
+		notify func(event *ChangeEvent)
+	}
+)
+
+var envNamePattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// NewRemoteSource returns the layer of config got from apollo,
+// it is added with PRIORITY_REMOTE by default, add it again by WithSource to change its priority
+func NewRemoteSource() Source {
+	return remoteSource{}
+}
+
+func (remoteSource) Name() string {
+	return remoteSourceName
+}
+
+func (remoteSource) Get(namespaceName, key string) (string, bool) {
+	ck := getCacheKey(namespaceName, key)
+	cacheMutex.Lock()
+	value, err := gConfigCache.Get([]byte(ck))
+	cacheMutex.Unlock()
+	if err != nil {
+		return EMPTY, false
+	}
+	return string(value), true
+}
+
+func (remoteSource) Keys(namespaceName string) []string {
+	nnd := namespaceName + SEP
+	keys := make([]string, 0)
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	it := gConfigCache.NewIterator()
+	for en := it.Next(); en != nil; en = it.Next() {
+		ck := string(en.Key)
+		if gIgnoreNameSpace {
+			// all namespaces are merged
+			keys = append(keys, ck)
+		} else if strings.HasPrefix(ck, nnd) && gConfigCache.Unmarshal(en.Value).NameSpace == namespaceName {
+			keys = append(keys, strings.TrimPrefix(ck, nnd))
+		}
+	}
+	return keys
+}
+
+// NewMapSource returns a layer of fixed configs, keyed by namespace then key, like defaults embedded in program
+func NewMapSource(name string, configs map[string]map[string]string) Source {
+	return &mapSource{name: name, configs: configs}
+}
+
+// NewFileSource reads a layer from a json or yaml file keyed by namespace then key, like local overrides.
+// values of other types than string are converted the same way as default values, missing file is an empty layer.
+//    application:
+//      db.host: localhost
+func NewFileSource(path string) (Source, error) {
+	configs := make(map[string]map[string]string)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &mapSource{name: "file:" + path, configs: configs}, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "ReadFile")
+	}
+
+	values := make(map[string]map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	default:
+		err = json.Unmarshal(b, &values)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode "+path)
+	}
+	for ns, kv := range values {
+		configs[ns] = make(map[string]string, len(kv))
+		for k, v := range kv {
+			configs[ns][k] = defaultString(toJsonValue(v))
+		}
+	}
+	return &mapSource{name: "file:" + path, configs: configs}, nil
+}
+
+func (s *mapSource) Name() string {
+	return s.name
+}
+
+func (s *mapSource) Get(namespaceName, key string) (string, bool) {
+	v, ok := s.configs[namespaceName][key]
+	return v, ok
+}
+
+func (s *mapSource) Keys(namespaceName string) []string {
+	keys := make([]string, 0, len(s.configs[namespaceName]))
+	for k := range s.configs[namespaceName] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// NewEnvSource returns a layer of environment variables, key of any namespace is read from
+// prefix followed by the key in upper case with non alphanumeric characters replaced by _,
+// for example db.host is read from APP_DB_HOST with prefix APP_
+func NewEnvSource(prefix string) Source {
+	return &envSource{prefix: prefix}
+}
+
+func (s *envSource) Name() string {
+	return "env:" + s.prefix
+}
+
+func (s *envSource) Get(namespaceName, key string) (string, bool) {
+	return os.LookupEnv(s.prefix + strings.ToUpper(envNamePattern.ReplaceAllString(key, "_")))
+}
+
+// NewOverrideSource returns an empty layer of values set by program
+func NewOverrideSource() *OverrideSource {
+	return &OverrideSource{values: make(map[string]map[string]string)}
+}
+
+func (s *OverrideSource) Name() string {
+	if s.name != EMPTY {
+		return s.name
+	}
+	return "override"
+}
+
+func (s *OverrideSource) Get(namespaceName, key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[namespaceName][key]
+	return v, ok
+}
+
+func (s *OverrideSource) Keys(namespaceName string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.values[namespaceName]))
+	for k := range s.values[namespaceName] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *OverrideSource) SetNotify(notify func(event *ChangeEvent)) {
+	s.mu.Lock()
+	s.notify = notify
+	s.mu.Unlock()
+}
+
+// Set overrides value of key in namespace
+func (s *OverrideSource) Set(namespaceName, key, value string) {
+	s.set(namespaceName, key, value)()
+}
+
+// Delete removes override of key in namespace
+func (s *OverrideSource) Delete(namespaceName, key string) {
+	s.delete(namespaceName, key)()
+}
+
+// set changes value and returns the func firing the change, which is called without lock held
+func (s *OverrideSource) set(namespaceName, key, value string) func() {
+	s.mu.Lock()
+	kv, ok := s.values[namespaceName]
+	if !ok {
+		kv = make(map[string]string)
+		s.values[namespaceName] = kv
+	}
+	old, ok := kv[key]
+	if ok && old == value {
+		s.mu.Unlock()
+		return func() {}
+	}
+	kv[key] = value
+	notify := s.notify
+	s.mu.Unlock()
+
+	change := newAddConfigChange(key, value)
+	if ok {
+		change = newModifyConfigChange(key, old, value)
+	}
+	return func() {
+		if notify != nil {
+			notify(&ChangeEvent{Namespace: namespaceName, Changes: []*ConfigChange{change}})
+		}
+	}
+}
+
+// delete removes value and returns the func firing the change, which is called without lock held
+func (s *OverrideSource) delete(namespaceName, key string) func() {
+	s.mu.Lock()
+	old, ok := s.values[namespaceName][key]
+	if !ok {
+		s.mu.Unlock()
+		return func() {}
+	}
+	delete(s.values[namespaceName], key)
+	notify := s.notify
+	s.mu.Unlock()
+
+	return func() {
+		if notify != nil {
+			notify(&ChangeEvent{Namespace: namespaceName, Changes: []*ConfigChange{newDeletedConfigChange(key, old)}})
+		}
+	}
+}
+
+// addLayer adds src to layers sorted by priority from high to low, the layer with the same name is replaced
+func addLayer(layers []layer, src Source, priority int) []layer {
+	ret := make([]layer, 0, len(layers)+1)
+	for _, l := range layers {
+		if l.src.Name() != src.Name() {
+			ret = append(ret, l)
+		}
+	}
+	ret = append(ret, layer{src: src, priority: priority})
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].priority > ret[j].priority
+	})
+	return ret
+}
+
+func getLayers() []layer {
+	if gOption == nil || len(gOption.layers) == 0 {
+		return []layer{{src: remoteSource{}, priority: PRIORITY_REMOTE}}
+	}
+	return gOption.layers
+}
+
+// layeredChangeEvent converts changes of values in src to changes of effective values,
+// changes shadowed by higher layers are dropped, deleted value falls back to lower layers.
+func layeredChangeEvent(src Source, event *ChangeEvent) *ChangeEvent {
+	layers := getLayers()
+	idx := -1
+	for i, l := range layers {
+		if l.src.Name() == src.Name() {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		// not a layer, nothing effective is changed
+		return &ChangeEvent{Namespace: event.Namespace, Changes: []*ConfigChange{}}
+	}
+
+	ret := &ChangeEvent{Namespace: event.Namespace, Changes: make([]*ConfigChange, 0, len(event.Changes))}
+	for _, c := range event.Changes {
+		if _, ok := layerValue(layers[:idx], event.Namespace, c.Key); ok {
+			continue
+		}
+		lower, hasLower := layerValue(layers[idx+1:], event.Namespace, c.Key)
+		oldValue, hasOld := c.OldValue, c.ChangeType != ADDED
+		if !hasOld {
+			oldValue, hasOld = lower, hasLower
+		}
+		newValue, hasNew := c.NewValue, c.ChangeType != DELETED
+		if !hasNew {
+			newValue, hasNew = lower, hasLower
+		}
+
+		switch {
+		case !hasOld:
+			ret.Changes = append(ret.Changes, newAddConfigChange(c.Key, newValue))
+		case !hasNew:
+			ret.Changes = append(ret.Changes, newDeletedConfigChange(c.Key, oldValue))
+		case oldValue != newValue:
+			ret.Changes = append(ret.Changes, newModifyConfigChange(c.Key, oldValue, newValue))
+		}
+	}
+	return ret
+}
+
+// layerKeys returns keys of namespace in all ListingSource layers, sorted
+func layerKeys(layers []layer, namespaceName string) []string {
+	set := make(map[string]struct{})
+	for _, l := range layers {
+		if ls, ok := l.src.(ListingSource); ok {
+			for _, k := range ls.Keys(namespaceName) {
+				set[k] = struct{}{}
+			}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func layerValue(layers []layer, namespaceName, key string) (string, bool) {
+	for _, l := range layers {
+		if v, ok := l.src.Get(namespaceName, key); ok {
+			return v, true
+		}
+	}
+	return EMPTY, false
+}
+
+// onSourceChange is notify of NotifyingSource, listeners and handler get changes of effective values
+func onSourceChange(src Source, event *ChangeEvent) {
+	effective := layeredChangeEvent(src, event)
+	if len(effective.Changes) == 0 {
+		return
+	}
+	notifyChangeListeners(effective)
+	pushChange(nil, effective)
+}
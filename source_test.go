@@ -0,0 +1,101 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource_Layers(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	os.Setenv("AGOLLO_TEST_DB_HOST", "env-host")
+	defer os.Unsetenv("AGOLLO_TEST_DB_HOST")
+
+	overrides := NewOverrideSource()
+	for _, opt := range []Option{
+		WithSource(NewEnvSource("AGOLLO_TEST_"), PRIORITY_ENV),
+		WithSource(overrides, PRIORITY_OVERRIDE),
+		WithSource(NewMapSource("embedded", map[string]map[string]string{
+			"application": {"db.host": "embedded-host", "db.port": "3306", "timeout": "1s"},
+		}), PRIORITY_EMBEDDED),
+	} {
+		opt.apply(gOption)
+	}
+	overrides.SetNotify(func(event *ChangeEvent) {
+		onSourceChange(overrides, event)
+	})
+	setTestConfig("application", map[string]string{"db.port": "3307", "db.host": "remote-host"})
+
+	cr := GetConfigReader("application")
+	host, _ := cr.GetStringValue("db.host")
+	assert.Equal(t, "env-host", host)
+	port, _ := cr.GetIntValue("db.port")
+	assert.Equal(t, 3307, port)
+	timeout, _ := cr.GetDurationValue("timeout")
+	assert.Equal(t, "1s", timeout.String())
+
+	var events []*ChangeEvent
+	RegChangeEventHandler(func(event *ChangeEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	defer RegChangeEventHandler(nil)
+
+	overrides.Set("application", "db.port", "3308")
+	overrides.Set("application", "db.host", "override-host")
+	overrides.Delete("application", "db.port")
+	assert.Equal(t, []*ChangeEvent{
+		{Namespace: "application", Changes: []*ConfigChange{newModifyConfigChange("db.port", "3307", "3308")}},
+		{Namespace: "application", Changes: []*ConfigChange{newModifyConfigChange("db.host", "env-host", "override-host")}},
+		{Namespace: "application", Changes: []*ConfigChange{newModifyConfigChange("db.port", "3308", "3307")}},
+	}, events)
+
+	// remote change shadowed by override is not effective, deleted remote value falls back to embedded
+	ns := &namespace{NamespaceName: "application"}
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: "application"},
+		Configurations: map[string]string{"db.host": "new-remote-host"},
+	}
+	effective := updateCache(cfg, ns, getChangeEvent(cfg))
+	assert.Equal(t, []*ChangeEvent{
+		{Namespace: "application", Changes: []*ConfigChange{newModifyConfigChange("db.port", "3307", "3306")}},
+	}, effective)
+	port, _ = cr.GetIntValue("db.port")
+	assert.Equal(t, 3306, port)
+}
+
+func TestSource_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agollo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "override.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("application:\n  db.port: 3306\n  hosts: [a, b]\n"), 0644))
+	src, err := NewFileSource(path)
+	assert.Nil(t, err)
+	v, ok := src.Get("application", "db.port")
+	assert.True(t, ok)
+	assert.Equal(t, "3306", v)
+	v, _ = src.Get("application", "hosts")
+	assert.Equal(t, "a,b", v)
+	_, ok = src.Get("other", "db.port")
+	assert.False(t, ok)
+
+	src, err = NewFileSource(filepath.Join(dir, "missing.json"))
+	assert.Nil(t, err)
+	_, ok = src.Get("application", "db.port")
+	assert.False(t, ok)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("application: ["), 0644))
+	_, err = NewFileSource(path)
+	assert.NotNil(t, err)
+
+	layers := addLayer(nil, NewRemoteSource(), PRIORITY_REMOTE)
+	layers = addLayer(layers, NewMapSource("a", nil), PRIORITY_FILE)
+	layers = addLayer(layers, NewRemoteSource(), PRIORITY_OVERRIDE)
+	assert.Len(t, layers, 2)
+	assert.Equal(t, remoteSourceName, layers[0].src.Name())
+}
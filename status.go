@@ -0,0 +1,250 @@
+package agollo
+
+import (
+	"fmt"
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/Shonminh/apollo-client/internal/logger"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Backup age policies, applied when a backup older than max age is loaded
+const (
+	// log a warning and use the backup
+	BACKUP_AGE_WARN BackupAgePolicy = iota
+	// refuse to use the backup
+	BACKUP_AGE_REFUSE
+	// use the backup and mark client degraded
+	BACKUP_AGE_DEGRADE
+)
+
+// BackupAgePolicy decides what to do with a backup older than max age
+type BackupAgePolicy int
+
+type (
+	// Status is the state of agollo client
+	Status struct {
+		// true if any namespace is degraded
+		Degraded   bool
+		Namespaces []NamespaceStatus
+	}
+
+	// NamespaceStatus is the state of a namespace
+	NamespaceStatus struct {
+		Namespace string
+		// config is loaded from backup, not from apollo
+		FromBackup bool
+		// config is loaded from the bundle set by WithEmbeddedFallback, neither apollo nor backup works
+		FromEmbedded bool
+		// config is loaded from a backup, or the embedded bundle, older than max age
+		Degraded bool
+		// release in backup is newer than the one in cache, it is written by another process,
+		// so backup is not written. empty if backup is written by this client
+		NewerBackup string
+		// time the backup was taken, zero if unknown
+		BackupTime time.Time
+		// age of the backup when status is got, zero if BackupTime is unknown
+		BackupAge time.Duration
+		// release in cache
+		ReleaseKey string
+		// time the release is put in cache, from apollo or backup
+		UpdateTime time.Time
+	}
+
+	namespaceStatus struct {
+		fromBackup   bool
+		fromEmbedded bool
+		degraded     bool
+		newerBackup  string
+		backupTime   time.Time
+		releaseKey   string
+		updateTime   time.Time
+		fetchTime    time.Time
+	}
+)
+
+var (
+	gStatus      = make(map[string]*namespaceStatus)
+	gStatusMutex sync.Mutex
+)
+
+// GetStatus returns the state of agollo client and its namespaces
+func GetStatus() *Status {
+	gStatusMutex.Lock()
+	defer gStatusMutex.Unlock()
+
+	now := time.Now()
+	ret := &Status{}
+	for ns, st := range gStatus {
+		nst := NamespaceStatus{
+			Namespace:    ns,
+			FromBackup:   st.fromBackup,
+			FromEmbedded: st.fromEmbedded,
+			Degraded:     st.degraded,
+			NewerBackup:  st.newerBackup,
+			BackupTime:   st.backupTime,
+			ReleaseKey:   st.releaseKey,
+			UpdateTime:   st.updateTime,
+		}
+		if !st.backupTime.IsZero() {
+			nst.BackupAge = now.Sub(st.backupTime)
+		}
+		ret.Degraded = ret.Degraded || st.degraded
+		ret.Namespaces = append(ret.Namespaces, nst)
+	}
+	sort.Slice(ret.Namespaces, func(i, j int) bool {
+		return ret.Namespaces[i].Namespace < ret.Namespaces[j].Namespace
+	})
+	return ret
+}
+
+func getNamespaceStatus(namespaceName string) *namespaceStatus {
+	st, ok := gStatus[namespaceName]
+	if !ok {
+		st = &namespaceStatus{}
+		gStatus[namespaceName] = st
+	}
+	return st
+}
+
+// recordBackupWritten is called when config got from apollo is written to backup
+func recordBackupWritten(namespaceName string, backupTime time.Time) {
+	gStatusMutex.Lock()
+	st := getNamespaceStatus(namespaceName)
+	st.fromBackup = false
+	st.fromEmbedded = false
+	st.degraded = false
+	st.newerBackup = EMPTY
+	st.backupTime = backupTime
+	gStatusMutex.Unlock()
+}
+
+// recordNewerBackup is called when backup is not written as it has a newer release written by another process
+func recordNewerBackup(namespaceName, releaseKey string) {
+	gStatusMutex.Lock()
+	getNamespaceStatus(namespaceName).newerBackup = releaseKey
+	gStatusMutex.Unlock()
+}
+
+// recordSynced is called when namespace is synced with apollo, config in cache is not from backup any more,
+// even if the release is not changed or the backup is not written
+func recordSynced(namespaceName string) {
+	gStatusMutex.Lock()
+	st := getNamespaceStatus(namespaceName)
+	st.fromBackup = false
+	st.fromEmbedded = false
+	st.degraded = false
+	gStatusMutex.Unlock()
+}
+
+// recordUpdated is called when a release fetched at fetchTime is put in cache
+func recordUpdated(namespaceName, releaseKey string, fetchTime time.Time) {
+	gStatusMutex.Lock()
+	st := getNamespaceStatus(namespaceName)
+	st.releaseKey = releaseKey
+	st.updateTime = time.Now()
+	st.fetchTime = fetchTime
+	gStatusMutex.Unlock()
+}
+
+func lookupNamespaceStatus(namespaceName string) (namespaceStatus, bool) {
+	gStatusMutex.Lock()
+	defer gStatusMutex.Unlock()
+	st, ok := gStatus[namespaceName]
+	if !ok {
+		return namespaceStatus{}, false
+	}
+	return *st, true
+}
+
+func recordBackupLoaded(namespaceName string, backupTime time.Time, degraded bool) {
+	gStatusMutex.Lock()
+	st := getNamespaceStatus(namespaceName)
+	st.fromBackup = true
+	st.fromEmbedded = false
+	st.degraded = degraded
+	st.backupTime = backupTime
+	gStatusMutex.Unlock()
+}
+
+func recordEmbeddedLoaded(namespaceName string, backupTime time.Time, degraded bool) {
+	gStatusMutex.Lock()
+	st := getNamespaceStatus(namespaceName)
+	st.fromBackup = false
+	st.fromEmbedded = true
+	st.degraded = degraded
+	st.backupTime = backupTime
+	gStatusMutex.Unlock()
+}
+
+// errBackupTooOld is returned when a backup is refused by BACKUP_AGE_REFUSE
+var errBackupTooOld = errors.New("backup is too old")
+
+// checkBackupAge applies the backup age policy to backup of namespace taken at backupTime,
+// degraded is true if client is degraded by using it
+func checkBackupAge(namespaceName string, backupTime time.Time) (degraded bool, err error) {
+	if gOption.backupMaxAge <= 0 {
+		return false, nil
+	}
+	// backup written by older version has no backup time, its age is unknown and treated as too old
+	age := time.Since(backupTime)
+	if !backupTime.IsZero() && age <= gOption.backupMaxAge {
+		return false, nil
+	}
+	msg := fmt.Sprintf("backup of %s is too old, taken at %v, max age %v", namespaceName, backupTime, gOption.backupMaxAge)
+	switch gOption.backupAgePolicy {
+	case BACKUP_AGE_REFUSE:
+		return false, errors.WithMessage(errBackupTooOld, msg)
+	case BACKUP_AGE_DEGRADE:
+		logger.LogError("%s, client is degraded", msg)
+		return true, nil
+	default:
+		logger.LogError("%s", msg)
+		return false, nil
+	}
+}
+
+// loadBackup loads config of namespace from backup and applies the backup age policy
+func loadBackup(namespaceName string) (*diskConfig, error) {
+	dc, err := loadDiskConfig(namespaceName)
+	if err != nil {
+		return nil, err
+	}
+	degraded, err := checkBackupAge(namespaceName, dc.BackupTime)
+	if err != nil {
+		return nil, err
+	}
+	recordBackupLoaded(namespaceName, dc.BackupTime, degraded)
+	return dc, nil
+}
+
+// loadFallback loads config of namespace from backup, then from the bundle set by WithEmbeddedFallback
+// if backup is missing or broken. a backup refused by age policy is not replaced by the bundle,
+// which is usually older, the age policy is applied to the bundle too.
+func loadFallback(namespaceName string) (*diskConfig, error) {
+	dc, err := loadBackup(namespaceName)
+	if err == nil || gOption.embeddedFallback == nil || errors.Cause(err) == errBackupTooOld {
+		return dc, err
+	}
+	logger.LogError("load backup of %s fail: %v, try embedded fallback", namespaceName, err)
+
+	// files in the bundle are named the same as backup files
+	data, e := fs.ReadFile(gOption.embeddedFallback, namespaceName+gOption.BackupSuffix)
+	if e == nil {
+		dc, _, e = decodeConfigFile(data)
+	}
+	degraded := false
+	if e == nil {
+		degraded, e = checkBackupAge(namespaceName, dc.BackupTime)
+	}
+	if e != nil {
+		return nil, multierror.Append(apollo.NewMutliError(), err, errors.WithMessage(e, "embedded fallback"))
+	}
+	logger.LogError("config of %s is loaded from embedded fallback, release %s", namespaceName, dc.ReleaseKey)
+	recordEmbeddedLoaded(namespaceName, dc.BackupTime, degraded)
+	return dc, nil
+}
@@ -0,0 +1,158 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func saveTestBackup(t *testing.T, store BackupStore, backupTime time.Time) {
+	dc := &diskConfig{
+		Config:     newTestConfig("r1", map[string]string{"a1": "11"}),
+		BackupTime: backupTime,
+	}
+	data, err := encodeConfigFile(dc)
+	assert.Nil(t, err)
+	assert.Nil(t, store.Save(TEST_DEFAULT_NAMESPACE_NAME, data))
+}
+
+func getTestNamespaceStatus(t *testing.T) NamespaceStatus {
+	for _, st := range GetStatus().Namespaces {
+		if st.Namespace == TEST_DEFAULT_NAMESPACE_NAME {
+			return st
+		}
+	}
+	t.Fatalf("status of %s not found", TEST_DEFAULT_NAMESPACE_NAME)
+	return NamespaceStatus{}
+}
+
+func TestStatus_loadBackup_MaxAgePolicy(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	gOption.backupMaxAge = time.Hour
+
+	saveTestBackup(t, store, time.Now().Add(-time.Minute))
+	gOption.backupAgePolicy = BACKUP_AGE_REFUSE
+	_, err := loadBackup(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	st := getTestNamespaceStatus(t)
+	assert.True(t, st.FromBackup)
+	assert.False(t, st.Degraded)
+	assert.True(t, st.BackupAge >= time.Minute)
+
+	saveTestBackup(t, store, time.Now().Add(-2*time.Hour))
+	_, err = loadBackup(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.NotNil(t, err)
+
+	gOption.backupAgePolicy = BACKUP_AGE_DEGRADE
+	_, err = loadBackup(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.True(t, getTestNamespaceStatus(t).Degraded)
+	assert.True(t, GetStatus().Degraded)
+
+	gOption.backupAgePolicy = BACKUP_AGE_WARN
+	_, err = loadBackup(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.False(t, getTestNamespaceStatus(t).Degraded)
+
+	// backup written by apollo sync is fresh
+	assert.Nil(t, writeConfigFile(newTestConfig("r2", map[string]string{"a1": "22"}), DEFAULT_NOFICATION_ID, time.Now()))
+	st = getTestNamespaceStatus(t)
+	assert.False(t, st.FromBackup)
+	assert.True(t, st.BackupAge < time.Minute)
+}
+
+func TestStatus_loadFallback_Embedded(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	s := &service{namespaceList: []*namespace{{NamespaceName: TEST_DEFAULT_NAMESPACE_NAME}}}
+	assert.NotNil(t, s.LoadConfigFile(nil))
+
+	data, err := encodeConfigFile(&diskConfig{Config: newTestConfig("embedded", map[string]string{"a1": "embedded"})})
+	assert.Nil(t, err)
+	WithEmbeddedFallback(fstest.MapFS{
+		TEST_DEFAULT_NAMESPACE_NAME + DEFAULT_BACKUPSUFFIX: &fstest.MapFile{Data: data},
+	}).apply(gOption)
+	assert.Nil(t, s.LoadConfigFile(nil))
+	v, _ := GetConfigReader(TEST_DEFAULT_NAMESPACE_NAME).GetStringValue("a1")
+	assert.Equal(t, "embedded", v)
+	st := getTestNamespaceStatus(t)
+	assert.True(t, st.FromEmbedded)
+	assert.False(t, st.FromBackup)
+	assert.Equal(t, "embedded", st.ReleaseKey)
+	assert.Equal(t, "embedded-fallback", Explain(TEST_DEFAULT_NAMESPACE_NAME, "a1").Source)
+
+	// backup is preferred
+	saveTestBackup(t, store, time.Now())
+	dc, err := loadFallback(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", dc.ReleaseKey)
+	st = getTestNamespaceStatus(t)
+	assert.True(t, st.FromBackup)
+	assert.False(t, st.FromEmbedded)
+}
+
+func TestStatus_syncConfig_NotModifiedClearsFromBackup(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	initCache(DEFAULT_CONFIGCACHESIZE, false)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	// quick init loaded the backup of the release in apollo
+	recordBackupLoaded(TEST_DEFAULT_NAMESPACE_NAME, time.Now().Add(-2*time.Hour), true)
+	s := &service{
+		ConfigCenter:  apollo.ConfigCenter{Host: apollo.NewSingleHostResolver(srv.URL), AppId: TEST_DEFAULT_APPID, Cluster: TEST_DEFAULT_CLUSTER},
+		namespaceList: []*namespace{{NamespaceName: TEST_DEFAULT_NAMESPACE_NAME, releaseKey: "r1"}},
+	}
+	assert.Nil(t, s.syncConfig(false, nil))
+	st := getTestNamespaceStatus(t)
+	assert.False(t, st.FromBackup)
+	assert.False(t, st.Degraded)
+}
+
+func TestStatus_loadFallback_EmbeddedMaxAgePolicy(t *testing.T) {
+	store := NewMemoryBackupStore()
+	defer useTestBackupStore(store)()
+	gOption.backupMaxAge = time.Hour
+	gOption.backupAgePolicy = BACKUP_AGE_REFUSE
+	setBundle := func(backupTime time.Time) {
+		data, err := encodeConfigFile(&diskConfig{
+			Config:     newTestConfig("embedded", map[string]string{"a1": "embedded"}),
+			BackupTime: backupTime,
+		})
+		assert.Nil(t, err)
+		WithEmbeddedFallback(fstest.MapFS{
+			TEST_DEFAULT_NAMESPACE_NAME + DEFAULT_BACKUPSUFFIX: &fstest.MapFile{Data: data},
+		}).apply(gOption)
+	}
+
+	// backup refused by policy is not replaced by the bundle
+	setBundle(time.Now())
+	saveTestBackup(t, store, time.Now().Add(-2*time.Hour))
+	_, err := loadFallback(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, store.Delete(TEST_DEFAULT_NAMESPACE_NAME))
+	dc, err := loadFallback(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	assert.Equal(t, "embedded", dc.ReleaseKey)
+
+	// old bundle is refused too
+	setBundle(time.Now().Add(-2 * time.Hour))
+	_, err = loadFallback(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.NotNil(t, err)
+
+	gOption.backupAgePolicy = BACKUP_AGE_DEGRADE
+	_, err = loadFallback(TEST_DEFAULT_NAMESPACE_NAME)
+	assert.Nil(t, err)
+	st := getTestNamespaceStatus(t)
+	assert.True(t, st.FromEmbedded)
+	assert.True(t, st.Degraded)
+}
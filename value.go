@@ -0,0 +1,105 @@
+package agollo
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Value is a typed handle of a config key, the value is parsed when the key changes,
+	// Get returns the cached parsed value without locking.
+	Value[T any] struct {
+		namespace  string
+		key        string
+		listenerId int64
+		v          atomic.Value
+	}
+
+	valueResult[T any] struct {
+		val T
+		err error
+	}
+)
+
+// Get reads key by reader and converts it to T, T is one of the types returned by ConfigReader getters:
+// string, int, float64, bool, []byte, time.Duration, int64, uint, ByteSize, time.Time,
+// []string, map[string]interface{} and []interface{}.
+func Get[T any](reader ConfigReader, key string) (T, error) {
+	var zero T
+	var v interface{}
+	var err error
+	switch interface{}(zero).(type) {
+	case string:
+		v, err = reader.GetStringValue(key)
+	case int:
+		v, err = reader.GetIntValue(key)
+	case float64:
+		v, err = reader.GetFloatValue(key)
+	case bool:
+		v, err = reader.GetBoolValue(key)
+	case []byte:
+		v, err = reader.GetBytesValue(key)
+	case time.Duration:
+		v, err = reader.GetDurationValue(key)
+	case int64:
+		v, err = reader.GetInt64Value(key)
+	case uint:
+		v, err = reader.GetUintValue(key)
+	case ByteSize:
+		var bs int64
+		bs, err = reader.GetByteSizeValue(key)
+		v = ByteSize(bs)
+	case time.Time:
+		v, err = reader.GetTimeValue(key)
+	case []string:
+		v, err = reader.GetStringSliceValue(key)
+	case map[string]interface{}:
+		v, err = reader.GetMapValue(key)
+	case []interface{}:
+		v, err = reader.GetSliceValue(key)
+	default:
+		return zero, errors.New(fmt.Sprintf("unsupported type %T", zero))
+	}
+	return v.(T), err
+}
+
+// NewValue returns a Value of key in namespace, call Close when it is not used anymore
+func NewValue[T any](namespaceName, key string) *Value[T] {
+	v := &Value[T]{
+		namespace: namespaceName,
+		key:       key,
+	}
+	v.load()
+	v.listenerId = addChangeListener(v.onChange)
+	return v
+}
+
+func (v *Value[T]) load() {
+	val, err := Get[T](GetConfigReader(v.namespace), v.key)
+	v.v.Store(&valueResult[T]{val: val, err: err})
+}
+
+func (v *Value[T]) onChange(event *ChangeEvent) {
+	if event.Namespace != v.namespace {
+		return
+	}
+	for _, c := range event.Changes {
+		if c.Key == v.key {
+			v.load()
+			return
+		}
+	}
+}
+
+// Get returns the parsed value and the error of the last parse
+func (v *Value[T]) Get() (T, error) {
+	r := v.v.Load().(*valueResult[T])
+	return r.val, r.err
+}
+
+// Close stops updating the value
+func (v *Value[T]) Close() {
+	removeChangeListener(v.listenerId)
+}
@@ -0,0 +1,55 @@
+package agollo
+
+import (
+	"github.com/Shonminh/apollo-client/internal/apollo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestValue_Get(t *testing.T) {
+	setTestConfig("application", map[string]string{
+		"timeout": "3s",
+		"size":    "2KB",
+	})
+	cr := GetConfigReader("application")
+
+	d, err := Get[time.Duration](cr, "timeout")
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, d)
+
+	sz, err := Get[ByteSize](cr, "size")
+	assert.Nil(t, err)
+	assert.Equal(t, ByteSize(2<<10), sz)
+
+	_, err = Get[complex64](cr, "size")
+	assert.NotNil(t, err)
+}
+
+func TestValue_UpdateOnChange(t *testing.T) {
+	defer useTestBackupStore(NewMemoryBackupStore())()
+	setTestConfig("application", map[string]string{
+		"timeout": "3s",
+	})
+
+	v := NewValue[time.Duration]("application", "timeout")
+	defer v.Close()
+	d, err := v.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, d)
+
+	ns := &namespace{NamespaceName: "application"}
+	cfg := &apollo.Config{
+		ConnConfig:     apollo.ConnConfig{NamespaceName: "application"},
+		Configurations: map[string]string{"timeout": "5s"},
+	}
+	updateCache(cfg, ns, getChangeEvent(cfg))
+	d, err = v.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, d)
+
+	cfg.Configurations = map[string]string{}
+	updateCache(cfg, ns, getChangeEvent(cfg))
+	_, err = v.Get()
+	assert.NotNil(t, err)
+}